@@ -0,0 +1,125 @@
+/*
+Copyright 2021 IBM Corporation
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"net/http"
+	"time"
+
+	"github.com/go-logr/logr"
+	"google.golang.org/grpc"
+
+	gw "github.com/kserve/rest-proxy/gen"
+)
+
+const (
+	accessLogEnvVar           = "REST_PROXY_ACCESS_LOG"
+	accessLogSampleRateEnvVar = "REST_PROXY_ACCESS_LOG_SAMPLE_RATE"
+)
+
+// Writes a JSON access log line for each REST request. Successful requests are
+// sampled at the given rate between 0 and 1, while failed requests are always
+// logged. A nil accessLogger disables the access log.
+type accessLogger struct {
+	log        logr.Logger
+	sampleRate float64
+}
+
+func newAccessLogger(log logr.Logger, sampleRate float64) (*accessLogger, error) {
+	if sampleRate < 0 || sampleRate > 1 {
+		return nil, fmt.Errorf("access log sample rate must be between 0 and 1, got %v", sampleRate)
+	}
+	return &accessLogger{log: log, sampleRate: sampleRate}, nil
+}
+
+// Per-request fields of the access log that are only known to the gRPC client.
+type accessLogEntry struct {
+	id     string
+	inputs []accessLogInput
+}
+
+type accessLogInput struct {
+	Name     string  `json:"name"`
+	Datatype string  `json:"datatype"`
+	Shape    []int64 `json:"shape"`
+}
+
+type accessLogEntryKey struct{}
+
+// This handler logs the requests served by next. The model, status codes, sizes
+// and timings are taken from the requestMetrics shared with proxyMetrics.handler
+// and set by metricsInterceptor and errorHandler.
+func (l *accessLogger) handler(next http.Handler) http.Handler {
+	if l == nil {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		rm, w, r := trackRequestMetrics(w, r)
+		entry := &accessLogEntry{}
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), accessLogEntryKey{}, entry)))
+
+		code := rm.statusCode()
+		if code < http.StatusBadRequest && rand.Float64() >= l.sampleRate {
+			return
+		}
+		keysAndValues := []interface{}{
+			"method", r.Method,
+			"path", r.URL.Path,
+			"model", rm.model,
+			"version", rm.version,
+			"id", entry.id,
+			"inputs", entry.inputs,
+			"status", code,
+			"grpcCode", rm.code,
+			"requestBytes", rm.requestSize,
+			"responseBytes", rm.responseSize,
+			"durationMs", milliseconds(time.Since(rm.start)),
+		}
+		if !rm.backendStart.IsZero() {
+			keysAndValues = append(keysAndValues,
+				"decodeMs", milliseconds(rm.backendStart.Sub(rm.start)),
+				"backendMs", milliseconds(rm.backendEnd.Sub(rm.backendStart)))
+			if !rm.firstWrite.IsZero() {
+				keysAndValues = append(keysAndValues, "encodeMs", milliseconds(rm.firstWrite.Sub(rm.backendEnd)))
+			}
+		}
+		l.log.Info("REST request", keysAndValues...)
+	})
+}
+
+func milliseconds(d time.Duration) float64 {
+	return float64(d.Microseconds()) / 1000
+}
+
+// This interceptor records the id and the input tensors of inference requests
+// for the access log.
+func accessLogInterceptor(ctx context.Context, method string, req, reply interface{},
+	cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+	if entry, _ := ctx.Value(accessLogEntryKey{}).(*accessLogEntry); entry != nil {
+		if r, ok := req.(*gw.ModelInferRequest); ok {
+			entry.id = r.Id
+			entry.inputs = make([]accessLogInput, len(r.Inputs))
+			for i, input := range r.Inputs {
+				entry.inputs[i] = accessLogInput{Name: input.Name, Datatype: input.Datatype, Shape: input.Shape}
+			}
+		}
+	}
+	return invoker(ctx, method, req, reply, cc, opts...)
+}
@@ -0,0 +1,114 @@
+/*
+Copyright 2021 IBM Corporation
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"sigs.k8s.io/controller-runtime/pkg/log/zap"
+)
+
+func TestAccessLog(t *testing.T) {
+	tests := []struct {
+		name       string
+		sampleRate float64
+		expected   []map[string]interface{}
+	}{
+		{
+			name:       "all requests",
+			sampleRate: 1,
+			expected: []map[string]interface{}{
+				{"method": "POST", "path": "/v2/models/example/infer", "model": "example", "version": "", "id": "req-1",
+					"inputs": []interface{}{map[string]interface{}{"name": "input", "datatype": "FP32", "shape": []interface{}{1.0}}},
+					"status": 200.0, "grpcCode": "OK"},
+				{"method": "POST", "path": "/v2/models/missing/infer", "model": "missing", "version": "", "id": "req-1",
+					"inputs": []interface{}{map[string]interface{}{"name": "input", "datatype": "FP32", "shape": []interface{}{1.0}}},
+					"status": 404.0, "grpcCode": "NotFound"},
+				{"method": "POST", "path": "/v2/models/example/infer", "model": "", "version": "", "id": "",
+					"inputs": nil, "status": 400.0, "grpcCode": "InvalidArgument"},
+			},
+		},
+		{
+			name:       "only failed requests",
+			sampleRate: 0,
+			expected: []map[string]interface{}{
+				{"method": "POST", "path": "/v2/models/missing/infer", "model": "missing", "version": "", "id": "req-1",
+					"inputs": []interface{}{map[string]interface{}{"name": "input", "datatype": "FP32", "shape": []interface{}{1.0}}},
+					"status": 404.0, "grpcCode": "NotFound"},
+				{"method": "POST", "path": "/v2/models/example/infer", "model": "", "version": "", "id": "",
+					"inputs": nil, "status": 400.0, "grpcCode": "InvalidArgument"},
+			},
+		},
+	}
+	body := `{"id":"req-1","inputs":[{"name":"input","datatype":"FP32","shape":[1],"data":[1.5]}]}`
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			buf := &bytes.Buffer{}
+			accessLog, err := newAccessLogger(zap.New(zap.WriteTo(buf)), tt.sampleRate)
+			if err != nil {
+				t.Fatal(err)
+			}
+			handler := newTestProxy(t, &testInferServer{}, nil, accessLog, nil)
+			for _, req := range []struct{ path, body string }{
+				{"/v2/models/example/infer", body},
+				{"/v2/models/missing/infer", body},
+				{"/v2/models/example/infer", `{"inputs":[{"name":"input","datatype":"FP32","shape":[1],"data":["a"]}]}`},
+			} {
+				handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("POST", req.path, strings.NewReader(req.body)))
+			}
+
+			var entries []map[string]interface{}
+			scanner := bufio.NewScanner(buf)
+			for scanner.Scan() {
+				entry := map[string]interface{}{}
+				if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+					t.Fatal(err)
+				}
+				if entry["msg"] != "REST request" {
+					continue
+				}
+				if entry["requestBytes"].(float64) <= 0 || entry["durationMs"].(float64) < 0 {
+					t.Errorf("unexpected sizes or timings in %v", entry)
+				}
+				if _, ok := entry["backendMs"]; ok != (entry["grpcCode"] != "InvalidArgument") {
+					t.Errorf("expected backend timings only for requests sent to the inference server: %v", entry)
+				}
+				for _, key := range []string{"level", "ts", "msg", "requestBytes", "responseBytes", "durationMs", "decodeMs", "backendMs", "encodeMs"} {
+					delete(entry, key)
+				}
+				entries = append(entries, entry)
+			}
+			if d := cmp.Diff(tt.expected, entries); d != "" {
+				t.Errorf("diff :%s", d)
+			}
+		})
+	}
+}
+
+func TestNewAccessLoggerSampleRate(t *testing.T) {
+	for _, rate := range []float64{-0.1, 1.5} {
+		if _, err := newAccessLogger(zap.New(), rate); err == nil {
+			t.Errorf("expected an error for sample rate %v", rate)
+		}
+	}
+}
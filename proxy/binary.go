@@ -0,0 +1,300 @@
+/*
+Copyright 2021 IBM Corporation
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+
+	"github.com/grpc-ecosystem/grpc-gateway/v2/runtime"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	gw "github.com/kserve/rest-proxy/gen"
+)
+
+// This file contains logic related to the binary tensor data extension, where
+// tensor data is appended to the JSON inference header as raw bytes
+// https://github.com/triton-inference-server/server/blob/main/docs/protocol/extension_binary_data.md
+
+const (
+	BINARY_TENSOR_DATA              = "binary_tensor_data"
+	BINARY_DATA                     = "binary_data"
+	BINARY_DATA_OUTPUT              = "binary_data_output"
+	BINARY_DATA_SIZE                = "binary_data_size"
+	INFERENCE_HEADER_CONTENT_LENGTH = "Inference-Header-Content-Length"
+)
+
+// Per-request state used to adjust how the outputs are returned. The requested
+// outputs are only known when the gRPC request is sent, and the size of the JSON
+// header only once the response body is written.
+type outputState struct {
+	allOutputs         bool                          // request-level binary_data_output parameter
+	outputs            map[string]bool               // binary_data parameter of each output
+	defaultContentType *gw.InferParameter            // request-level content_type parameter
+	contentTypes       map[string]*gw.InferParameter // requested content_type of each output
+	binary             bool                          // the response body includes binary data
+	size               int                           // total size of the binary data in the response body
+}
+
+type outputStateKey struct{}
+
+// This handler separates the JSON inference header from the binary tensor data
+// based on the Inference-Header-Content-Length header. Any whitespace padding at
+// the end of the JSON header is dropped so that the binary data immediately
+// follows the JSON object when it is decoded.
+// It also sets up the state needed to return binary output data in the response.
+func binaryDataHandler(mux *runtime.ServeMux) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if hl := r.Header.Get(INFERENCE_HEADER_CONTENT_LENGTH); hl != "" {
+			if err := splitInferenceHeader(r, hl); err != nil {
+				_, outboundMarshaler := runtime.MarshalerForRequest(mux, r)
+				runtime.HTTPError(r.Context(), mux, outboundMarshaler, w, r,
+					status.Error(codes.InvalidArgument, err.Error()))
+				return
+			}
+		}
+		state := &outputState{}
+		bw := &binaryResponseWriter{ResponseWriter: w, state: state}
+		mux.ServeHTTP(bw, r.WithContext(context.WithValue(r.Context(), outputStateKey{}, state)))
+		bw.flush()
+	})
+}
+
+type splitBody struct {
+	io.Reader
+	io.Closer
+}
+
+func splitInferenceHeader(r *http.Request, headerLength string) error {
+	length, err := strconv.Atoi(headerLength)
+	if err != nil || length <= 0 {
+		return fmt.Errorf("invalid %s: %s", INFERENCE_HEADER_CONTENT_LENGTH, headerLength)
+	}
+	if maxRequestBodyBytes > 0 && length > maxRequestBodyBytes {
+		return fmt.Errorf("%s %d exceeds the request body limit of %d bytes",
+			INFERENCE_HEADER_CONTENT_LENGTH, length, maxRequestBodyBytes)
+	}
+	if r.ContentLength >= 0 && int64(length) > r.ContentLength {
+		return fmt.Errorf("%s %d exceeds the request body length %d",
+			INFERENCE_HEADER_CONTENT_LENGTH, length, r.ContentLength)
+	}
+	// the header is read rather than allocated up front, as the length is only
+	// bounded by the size of the body when the body is chunked
+	header, err := io.ReadAll(io.LimitReader(r.Body, int64(length)))
+	if err != nil {
+		return fmt.Errorf("failed to read the inference header: %w", err)
+	}
+	if len(header) < length {
+		return fmt.Errorf("request body is shorter than %s %d", INFERENCE_HEADER_CONTENT_LENGTH, length)
+	}
+	trimmed := bytes.TrimRight(header, " \t\r\n")
+	if r.ContentLength > 0 {
+		r.ContentLength -= int64(len(header) - len(trimmed))
+	}
+	r.Body = splitBody{io.MultiReader(bytes.NewReader(trimmed), r.Body), r.Body}
+	return nil
+}
+
+// Returns the size of the tensor's binary data if the binary_data_size
+// parameter is present.
+func binaryDataSize(tensor *gw.ModelInferRequest_InferInputTensor) (int, bool, error) {
+	p, ok := tensor.Parameters[BINARY_DATA_SIZE]
+	if !ok {
+		return 0, false, nil
+	}
+	size, ok := p.GetParameterChoice().(*gw.InferParameter_Int64Param)
+	if !ok || size.Int64Param < 0 {
+		return 0, true, fmt.Errorf("%s parameter of input tensor %s must be a non-negative integer",
+			BINARY_DATA_SIZE, tensor.Name)
+	}
+	return int(size.Int64Param), true, nil
+}
+
+// Slices the binary data of the given tensor from the front of the remaining
+// binary request data, validating the size against the tensor shape.
+func sliceBinaryData(tensor *gw.ModelInferRequest_InferInputTensor, size int, data []byte) ([]byte, []byte, error) {
+	if size > len(data) {
+		return nil, nil, fmt.Errorf("%s %d of input tensor %s exceeds the remaining binary data (%d bytes)",
+			BINARY_DATA_SIZE, size, tensor.Name, len(data))
+	}
+	if tt, ok := tensorTypes[tensor.Datatype]; ok && tensor.Datatype != BYTES {
+		if expected := elementCount(tensor.Shape) * int64(tt.size); int64(size) != expected {
+			return nil, nil, fmt.Errorf("%s %d of input tensor %s does not match the %d bytes expected for shape %v",
+				BINARY_DATA_SIZE, size, tensor.Name, expected, tensor.Shape)
+		}
+	}
+	return data[:size:size], data[size:], nil
+}
+
+// This interceptor records which outputs of an inference request should be
+// returned as binary data, removing the REST-only parameters before the request
+// is sent, and then converts those outputs in the response to raw bytes. The
+// requested content type of each output is also applied to the response.
+func requestedOutputsInterceptor(ctx context.Context, method string, req, reply interface{},
+	cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+	state, _ := ctx.Value(outputStateKey{}).(*outputState)
+	inferReq, ok := req.(*gw.ModelInferRequest)
+	if state == nil || !ok {
+		return invoker(ctx, method, req, reply, cc, opts...)
+	}
+	state.recordRequestedOutputs(inferReq)
+	if err := invoker(ctx, method, req, reply, cc, opts...); err != nil {
+		return err
+	}
+	resp := reply.(*gw.ModelInferResponse)
+	state.setContentTypes(resp)
+	return state.setBinaryOutputs(resp)
+}
+
+func (s *outputState) recordRequestedOutputs(req *gw.ModelInferRequest) {
+	if p, ok := req.Parameters[BINARY_DATA_OUTPUT]; ok {
+		s.allOutputs = p.GetBoolParam()
+		delete(req.Parameters, BINARY_DATA_OUTPUT)
+	}
+	s.defaultContentType = req.Parameters[CONTENT_TYPE]
+	for _, output := range req.Outputs {
+		if p, ok := output.Parameters[CONTENT_TYPE]; ok {
+			if s.contentTypes == nil {
+				s.contentTypes = make(map[string]*gw.InferParameter, len(req.Outputs))
+			}
+			s.contentTypes[output.Name] = p
+		}
+		if p, ok := output.Parameters[BINARY_DATA]; ok {
+			if s.outputs == nil {
+				s.outputs = make(map[string]bool, len(req.Outputs))
+			}
+			s.outputs[output.Name] = p.GetBoolParam()
+			delete(output.Parameters, BINARY_DATA)
+		}
+	}
+}
+
+// Sets the requested content_type of BYTES outputs for which the server did not
+// return one. The request-level content_type applies to outputs without one.
+func (s *outputState) setContentTypes(resp *gw.ModelInferResponse) {
+	for _, output := range resp.Outputs {
+		p, ok := s.contentTypes[output.Name]
+		if !ok {
+			p = s.defaultContentType
+		}
+		if p == nil || output.Datatype != BYTES {
+			continue
+		}
+		if _, ok := output.Parameters[CONTENT_TYPE]; !ok {
+			if output.Parameters == nil {
+				output.Parameters = make(map[string]*gw.InferParameter, 1)
+			}
+			output.Parameters[CONTENT_TYPE] = p
+		}
+	}
+}
+
+// The binary_data parameter of an output overrides the request-level binary_data_output.
+func (s *outputState) isBinary(output string) bool {
+	if binary, ok := s.outputs[output]; ok {
+		return binary
+	}
+	return s.allOutputs
+}
+
+// Sets the binary_data_size parameter of the outputs to be returned as binary
+// data, these are appended to the JSON response body as-is by transformResponse.
+func (s *outputState) setBinaryOutputs(resp *gw.ModelInferResponse) error {
+	binaryOutputs := false
+	for _, output := range resp.Outputs {
+		binaryOutputs = binaryOutputs || s.isBinary(output.Name)
+	}
+	if !binaryOutputs {
+		return nil
+	}
+	if resp.RawOutputContents == nil {
+		// raw_output_contents must be used for all of the outputs if used for any
+		resp.RawOutputContents = make([][]byte, len(resp.Outputs))
+		for i, output := range resp.Outputs {
+			raw, err := rawContents(output.Datatype, output.Name, output.Contents)
+			if err != nil {
+				return fmt.Errorf("error converting output tensor %s to raw contents: %w", output.Name, err)
+			}
+			resp.RawOutputContents[i] = raw
+			output.Contents = nil
+		}
+	}
+	for i, output := range resp.Outputs {
+		if !s.isBinary(output.Name) || i >= len(resp.RawOutputContents) {
+			continue
+		}
+		if output.Parameters == nil {
+			output.Parameters = make(map[string]*gw.InferParameter, 1)
+		}
+		size := len(resp.RawOutputContents[i])
+		output.Parameters[BINARY_DATA_SIZE] = &gw.InferParameter{
+			ParameterChoice: &gw.InferParameter_Int64Param{Int64Param: int64(size)},
+		}
+		s.size += size
+		s.binary = true
+	}
+	return nil
+}
+
+// Returns the binary_data_size parameter of an output tensor set by setBinaryOutputs.
+func outputBinaryDataSize(output *gw.ModelInferResponse_InferOutputTensor) (int64, bool) {
+	p, ok := output.Parameters[BINARY_DATA_SIZE].GetParameterChoice().(*gw.InferParameter_Int64Param)
+	if !ok {
+		return 0, false
+	}
+	return p.Int64Param, true
+}
+
+// This writer defers writing the response status until the body is written, so
+// that the Inference-Header-Content-Length header can be set for responses
+// including binary data. The gateway writes the whole response body at once.
+type binaryResponseWriter struct {
+	http.ResponseWriter
+	state       *outputState
+	status      int
+	wroteHeader bool
+}
+
+func (w *binaryResponseWriter) WriteHeader(status int) {
+	if w.status == 0 {
+		w.status = status
+	}
+}
+
+func (w *binaryResponseWriter) Write(p []byte) (int, error) {
+	if !w.wroteHeader {
+		if w.state.binary && (w.status == 0 || w.status == http.StatusOK) && len(p) >= w.state.size {
+			w.Header().Set(INFERENCE_HEADER_CONTENT_LENGTH, strconv.Itoa(len(p)-w.state.size))
+			w.Header().Set("Content-Type", "application/octet-stream")
+		}
+		w.flush()
+	}
+	return w.ResponseWriter.Write(p)
+}
+
+func (w *binaryResponseWriter) flush() {
+	if !w.wroteHeader && w.status != 0 {
+		w.ResponseWriter.WriteHeader(w.status)
+	}
+	w.wroteHeader = true
+}
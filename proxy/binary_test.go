@@ -0,0 +1,242 @@
+/*
+Copyright 2021 IBM Corporation
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/grpc-ecosystem/grpc-gateway/v2/runtime"
+	"google.golang.org/grpc"
+	"google.golang.org/protobuf/proto"
+
+	gw "github.com/kserve/rest-proxy/gen"
+)
+
+func TestBinaryDataHandler(t *testing.T) {
+	var received []byte
+	mux := runtime.NewServeMux()
+	if err := mux.HandlePath("POST", "/v2/models/{name}/infer", func(w http.ResponseWriter, r *http.Request, _ map[string]string) {
+		received, _ = io.ReadAll(r.Body)
+	}); err != nil {
+		t.Fatal(err)
+	}
+	handler := binaryDataHandler(mux)
+
+	header := `{"inputs":[]}` + "  \n"
+	body := append([]byte(header), '\n', 0x01, 0x02)
+	req := httptest.NewRequest("POST", "/v2/models/example/infer", bytes.NewReader(body))
+	req.Header.Set(INFERENCE_HEADER_CONTENT_LENGTH, strconv.Itoa(len(header)))
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Errorf("unexpected status %d: %s", w.Code, w.Body.String())
+	}
+	if d := cmp.Diff([]byte{'{', '"', 'i', 'n', 'p', 'u', 't', 's', '"', ':', '[', ']', '}', '\n', 0x01, 0x02}, received); d != "" {
+		t.Errorf("diff :%s", d)
+	}
+
+	for _, length := range []string{"abc", "-1", "100"} {
+		req = httptest.NewRequest("POST", "/v2/models/example/infer", bytes.NewReader(body))
+		req.Header.Set(INFERENCE_HEADER_CONTENT_LENGTH, length)
+		w = httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("expected status 400 for header length %s, got %d", length, w.Code)
+		}
+	}
+}
+
+func TestSplitInferenceHeaderLength(t *testing.T) {
+	prev := maxRequestBodyBytes
+	maxRequestBodyBytes = 0 // the length must be bounded even without a body limit
+	defer func() { maxRequestBodyBytes = prev }()
+
+	body := `{"inputs":[]}`
+	tests := []struct {
+		name     string
+		body     io.Reader
+		expected string
+	}{
+		{"known body length", bytes.NewReader([]byte(body)),
+			"Inference-Header-Content-Length 10000000000000 exceeds the request body length 13"},
+		{"chunked body", io.MultiReader(bytes.NewReader([]byte(body))),
+			"request body is shorter than Inference-Header-Content-Length 10000000000000"},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest("POST", "/v2/models/example/infer", tt.body)
+		err := splitInferenceHeader(req, "10000000000000")
+		if err == nil || err.Error() != tt.expected {
+			t.Errorf("%s: expected error %q, got %v", tt.name, tt.expected, err)
+		}
+	}
+}
+
+func TestBinaryDataOutputs(t *testing.T) {
+	state := &outputState{}
+	ctx := context.WithValue(context.Background(), outputStateKey{}, state)
+	req := &gw.ModelInferRequest{
+		ModelName: "example",
+		Outputs: []*gw.ModelInferRequest_InferRequestedOutputTensor{
+			{Name: "predict", Parameters: map[string]*gw.InferParameter{BINARY_DATA: TRUE_PARAM}},
+			{Name: "labels", Parameters: map[string]*gw.InferParameter{BINARY_DATA: FALSE_PARAM}},
+		},
+	}
+	invoker := func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, opts ...grpc.CallOption) error {
+		for _, output := range req.(*gw.ModelInferRequest).Outputs {
+			if len(output.Parameters) != 0 {
+				t.Errorf("unexpected parameters sent for output %s: %v", output.Name, output.Parameters)
+			}
+		}
+		proto.Merge(reply.(proto.Message), &gw.ModelInferResponse{
+			ModelName: "example",
+			Outputs: []*gw.ModelInferResponse_InferOutputTensor{
+				{Name: "predict", Datatype: INT32, Shape: []int64{2}, Contents: &gw.InferTensorContents{IntContents: []int32{1, 2}}},
+				{Name: "labels", Datatype: BYTES, Shape: []int64{1}, Contents: &gw.InferTensorContents{BytesContents: [][]byte{[]byte("a")}}},
+			},
+		})
+		return nil
+	}
+	resp := &gw.ModelInferResponse{}
+	if err := requestedOutputsInterceptor(ctx, "/inference.GRPCInferenceService/ModelInfer", req, resp, nil, invoker); err != nil {
+		t.Fatal(err)
+	}
+
+	marshaler := &CustomJSONPb{}
+	buf, err := marshaler.Marshal(resp)
+	if err != nil {
+		t.Fatal(err)
+	}
+	header := `{"model_name":"example","outputs":[{"name":"predict","datatype":"INT32","shape":[2],"parameters":{"binary_data_size":8}},` +
+		`{"name":"labels","datatype":"BYTES","shape":[1],"parameters":{"content_type":"base64"},"data":["YQ=="]}]}`
+	expected := append([]byte(header), 1, 0, 0, 0, 2, 0, 0, 0)
+	if d := cmp.Diff(string(expected), string(buf)); d != "" {
+		t.Errorf("diff :%s", d)
+	}
+	if !state.binary || state.size != 8 {
+		t.Errorf("unexpected binary data state %+v", state)
+	}
+
+	// the header length is only set on successful responses
+	for _, code := range []int{http.StatusOK, http.StatusBadRequest} {
+		w := httptest.NewRecorder()
+		bw := &binaryResponseWriter{ResponseWriter: w, state: state}
+		bw.WriteHeader(code)
+		bw.Write(buf)
+		bw.flush()
+		if w.Code != code {
+			t.Errorf("expected status %d, got %d", code, w.Code)
+		}
+		expectedLength := ""
+		if code == http.StatusOK {
+			expectedLength = strconv.Itoa(len(header))
+		}
+		if hl := w.Header().Get(INFERENCE_HEADER_CONTENT_LENGTH); hl != expectedLength {
+			t.Errorf("expected %s %q for status %d, got %q", INFERENCE_HEADER_CONTENT_LENGTH, expectedLength, code, hl)
+		}
+	}
+}
+
+func TestBinaryDataOutputRequestParameter(t *testing.T) {
+	state := &outputState{}
+	req := &gw.ModelInferRequest{
+		Parameters: map[string]*gw.InferParameter{BINARY_DATA_OUTPUT: TRUE_PARAM},
+	}
+	state.recordRequestedOutputs(req)
+	if len(req.Parameters) != 0 {
+		t.Errorf("unexpected parameters sent: %v", req.Parameters)
+	}
+	resp := &gw.ModelInferResponse{
+		Outputs: []*gw.ModelInferResponse_InferOutputTensor{
+			{Name: "a", Datatype: FP32, Shape: []int64{1}},
+			{Name: "b", Datatype: INT8, Shape: []int64{2}},
+		},
+		RawOutputContents: [][]byte{{0, 0, 128, 63}, {1, 2}},
+	}
+	if err := state.setBinaryOutputs(resp); err != nil {
+		t.Fatal(err)
+	}
+	for i, output := range resp.Outputs {
+		if size, ok := outputBinaryDataSize(output); !ok || size != int64(len(resp.RawOutputContents[i])) {
+			t.Errorf("unexpected %s %d for output %s", BINARY_DATA_SIZE, size, output.Name)
+		}
+	}
+	if state.size != 6 {
+		t.Errorf("expected binary data size 6, got %d", state.size)
+	}
+}
+
+func TestRequestedOutputContentType(t *testing.T) {
+	state := &outputState{}
+	utf8Param := &gw.InferParameter{ParameterChoice: &gw.InferParameter_StringParam{StringParam: "utf8"}}
+	state.recordRequestedOutputs(&gw.ModelInferRequest{
+		Outputs: []*gw.ModelInferRequest_InferRequestedOutputTensor{
+			{Name: "text", Parameters: map[string]*gw.InferParameter{CONTENT_TYPE: utf8Param}},
+			{Name: "scores", Parameters: map[string]*gw.InferParameter{CONTENT_TYPE: utf8Param}},
+		},
+	})
+	resp := &gw.ModelInferResponse{
+		Outputs: []*gw.ModelInferResponse_InferOutputTensor{
+			{Name: "text", Datatype: BYTES},
+			{Name: "scores", Datatype: FP32},
+		},
+	}
+	state.setContentTypes(resp)
+	if p := resp.Outputs[0].Parameters[CONTENT_TYPE]; !proto.Equal(p, utf8Param) {
+		t.Errorf("expected requested content_type for BYTES output, got %v", p)
+	}
+	if p := resp.Outputs[1].Parameters; p != nil {
+		t.Errorf("unexpected parameters for FP32 output: %v", p)
+	}
+}
+
+func TestRequestLevelOutputParameters(t *testing.T) {
+	state := &outputState{}
+	b64Param := &gw.InferParameter{ParameterChoice: &gw.InferParameter_StringParam{StringParam: "b64"}}
+	utf8Param := &gw.InferParameter{ParameterChoice: &gw.InferParameter_StringParam{StringParam: "utf8"}}
+	state.recordRequestedOutputs(&gw.ModelInferRequest{
+		Parameters: map[string]*gw.InferParameter{BINARY_DATA_OUTPUT: TRUE_PARAM, CONTENT_TYPE: utf8Param},
+		Outputs: []*gw.ModelInferRequest_InferRequestedOutputTensor{
+			{Name: "encoded", Parameters: map[string]*gw.InferParameter{BINARY_DATA: FALSE_PARAM, CONTENT_TYPE: b64Param}},
+			{Name: "text", Parameters: map[string]*gw.InferParameter{BINARY_DATA: FALSE_PARAM}},
+		},
+	})
+	resp := &gw.ModelInferResponse{
+		Outputs: []*gw.ModelInferResponse_InferOutputTensor{
+			{Name: "encoded", Datatype: BYTES},
+			{Name: "text", Datatype: BYTES},
+			{Name: "scores", Datatype: FP32},
+		},
+	}
+	state.setContentTypes(resp)
+	for i, expected := range []*gw.InferParameter{b64Param, utf8Param} {
+		if p := resp.Outputs[i].Parameters[CONTENT_TYPE]; !proto.Equal(p, expected) {
+			t.Errorf("expected content_type %v for output %s, got %v", expected, resp.Outputs[i].Name, p)
+		}
+	}
+	for output, expected := range map[string]bool{"encoded": false, "text": false, "scores": true} {
+		if state.isBinary(output) != expected {
+			t.Errorf("expected binary %t for output %s", expected, output)
+		}
+	}
+}
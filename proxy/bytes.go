@@ -100,7 +100,9 @@ func unmarshalNestedNumeric(target *[][]byte, depth int, data []byte) error {
 
 func unmarshalStringArray(target *[][]byte, shape []int64, b64 bool, data []byte) error {
 	elems := int(elementCount(shape))
-	t := make([][]byte, 0, elems)
+	// each string takes at least 3 bytes of JSON, so the capacity is also bounded
+	// by the size of the data whatever the shape claims
+	t := make([][]byte, 0, min(elems, len(data)/3+1))
 
 	depth := 0
 	strStart := -1
@@ -188,6 +190,27 @@ func isBase64Content(parameters map[string]*gw.InferParameter) bool {
 	return false
 }
 
+// Returns true if the content_type parameter explicitly asks for utf8 strings.
+func isUTF8Content(parameters map[string]*gw.InferParameter) bool {
+	switch parameters[CONTENT_TYPE].GetStringParam() {
+	case "utf8", "str", "UTF8", "utf-8", "UTF-8":
+		return true
+	}
+	return false
+}
+
+// Returns the BYTES tensor elements as strings if they are all valid utf8.
+func utf8Strings(elements [][]byte) ([]string, bool) {
+	strs := make([]string, len(elements))
+	for i, e := range elements {
+		if !utf8.Valid(e) {
+			return nil, false
+		}
+		strs[i] = string(e)
+	}
+	return strs, true
+}
+
 // Split raw bytes into separate byte arrays based on 4-byte size delimeters
 func splitRawBytes(raw []byte, expectedSize int) ([][]byte, error) {
 	off, length := int64(0), int64(len(raw))
@@ -209,3 +232,17 @@ func splitRawBytes(raw []byte, expectedSize int) ([][]byte, error) {
 	}
 	return strings, nil
 }
+
+// Join byte arrays into raw bytes using 4-byte size delimiters
+func joinRawBytes(strings [][]byte) []byte {
+	size := 0
+	for _, s := range strings {
+		size += 4 + len(s)
+	}
+	raw := make([]byte, 0, size)
+	for _, s := range strings {
+		raw = binary.LittleEndian.AppendUint32(raw, uint32(len(s)))
+		raw = append(raw, s...)
+	}
+	return raw
+}
@@ -0,0 +1,146 @@
+/*
+Copyright 2021 IBM Corporation
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"os"
+	"sync/atomic"
+	"time"
+)
+
+// A value parsed from one or more files, which is replaced whenever the
+// contents of the files change and can be parsed successfully.
+type reloadable[T any] struct {
+	paths    []string
+	parse    func(contents [][]byte) (*T, error)
+	contents [][]byte
+	value    atomic.Pointer[T]
+}
+
+func (r *reloadable[T]) Load() *T {
+	return r.value.Load()
+}
+
+// Reads the files and parses them if they have changed, returning whether the
+// value was replaced. The previous value is kept if the files can't be parsed.
+func (r *reloadable[T]) reload() (bool, error) {
+	contents := make([][]byte, len(r.paths))
+	changed := r.contents == nil
+	for i, path := range r.paths {
+		var err error
+		if contents[i], err = os.ReadFile(path); err != nil {
+			return false, err
+		}
+		changed = changed || !bytes.Equal(contents[i], r.contents[i])
+	}
+	if !changed {
+		return false, nil
+	}
+	// the contents are recorded even if invalid so that the error is only
+	// reported once, the files are parsed again on the next change
+	r.contents = contents
+	value, err := r.parse(contents)
+	if err != nil {
+		return false, err
+	}
+	r.value.Store(value)
+	return true, nil
+}
+
+type reloader interface {
+	reload() (bool, error)
+}
+
+// Keeps track of the TLS certificates and CA bundles in use so that they can be
+// reloaded when they are rotated, e.g. by cert-manager.
+type certWatcher struct {
+	reloadables []reloader
+	names       []string
+}
+
+func (w *certWatcher) keyPair(name, certPath, keyPath string) (*reloadable[tls.Certificate], error) {
+	r := &reloadable[tls.Certificate]{paths: []string{certPath, keyPath},
+		parse: func(contents [][]byte) (*tls.Certificate, error) {
+			cert, err := tls.X509KeyPair(contents[0], contents[1])
+			return &cert, err
+		},
+	}
+	return r, w.add(name, r)
+}
+
+func (w *certWatcher) certPool(name, path string) (*reloadable[x509.CertPool], error) {
+	r := &reloadable[x509.CertPool]{paths: []string{path},
+		parse: func(contents [][]byte) (*x509.CertPool, error) {
+			pool := x509.NewCertPool()
+			if !pool.AppendCertsFromPEM(contents[0]) {
+				return nil, fmt.Errorf("no valid CA certificates found in %s", path)
+			}
+			return pool, nil
+		},
+	}
+	return r, w.add(name, r)
+}
+
+// Loads the initial value, which must succeed.
+func (w *certWatcher) add(name string, r reloader) error {
+	if _, err := r.reload(); err != nil {
+		return fmt.Errorf("error loading %s: %w", name, err)
+	}
+	w.reloadables = append(w.reloadables, r)
+	w.names = append(w.names, name)
+	return nil
+}
+
+// Periodically checks the files for changes until the context is cancelled.
+// Polling is used since Kubernetes updates mounted secrets by swapping symlinks.
+func (w *certWatcher) watch(ctx context.Context, interval time.Duration) {
+	if len(w.reloadables) == 0 || interval <= 0 {
+		return
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			w.reload()
+		}
+	}
+}
+
+func (w *certWatcher) reload() {
+	for i, r := range w.reloadables {
+		reloaded, err := r.reload()
+		if err != nil {
+			if errors.Is(err, os.ErrNotExist) {
+				// may be mid-rotation, the files are checked again on the next tick
+				logger.Info("TLS file not found, keeping the current one", "name", w.names[i], "error", err.Error())
+			} else {
+				logger.Error(err, "Failed to reload TLS file, keeping the current one", "name", w.names[i])
+			}
+		} else if reloaded {
+			logger.Info("Reloaded TLS file", "name", w.names[i])
+		}
+	}
+}
@@ -0,0 +1,75 @@
+/*
+Copyright 2021 IBM Corporation
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"os"
+	"testing"
+)
+
+func TestCertWatcherReload(t *testing.T) {
+	dir := t.TempDir()
+	ca := writeTestCert(t, dir, "ca", nil)
+	first := writeTestCert(t, dir, "server", ca)
+
+	w := &certWatcher{}
+	cert, err := w.keyPair("TLS certificate", first.certPath, first.keyPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pool, err := w.certPool("CA certificates", ca.certPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	initialPool := pool.Load()
+
+	// unchanged files are not parsed again
+	w.reload()
+	if pool.Load() != initialPool {
+		t.Error("expected unchanged CA bundle to be kept")
+	}
+
+	// rotated certificate and CA
+	second := writeTestCert(t, dir, "server", ca)
+	writeTestCert(t, dir, "ca", nil)
+	w.reload()
+	if !second.cert.Equal(mustParseLeaf(t, cert.Load().Certificate[0])) {
+		t.Error("expected rotated certificate to be loaded")
+	}
+	if pool.Load() == initialPool {
+		t.Error("expected rotated CA bundle to be loaded")
+	}
+
+	// invalid files keep the current certificate
+	if err = os.WriteFile(second.certPath, []byte("not a certificate"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err = os.Remove(ca.certPath); err != nil {
+		t.Fatal(err)
+	}
+	w.reload()
+	if !second.cert.Equal(mustParseLeaf(t, cert.Load().Certificate[0])) {
+		t.Error("expected current certificate to be kept")
+	}
+	if pool.Load() == nil {
+		t.Error("expected current CA bundle to be kept")
+	}
+
+	if _, err = w.keyPair("missing certificate", dir+"/missing.crt", first.keyPath); err == nil {
+		t.Error("expected error loading missing certificate")
+	}
+}
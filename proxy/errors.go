@@ -0,0 +1,93 @@
+/*
+Copyright 2021 IBM Corporation
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+
+	"github.com/grpc-ecosystem/grpc-gateway/v2/runtime"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// Error response body as defined by the V2 REST protocol.
+type ErrorResponse struct {
+	Error string `json:"error"`
+}
+
+// This function replaces the gateway's default error handler, which returns
+// the gRPC status as JSON, with one returning the error message in the format
+// defined by the V2 REST protocol. It is used for errors returned by the gRPC
+// server as well as for errors converting requests and responses, which are
+// returned as InvalidArgument and Unknown status errors respectively.
+func errorHandler(ctx context.Context, mux *runtime.ServeMux, marshaler runtime.Marshaler,
+	w http.ResponseWriter, r *http.Request, err error) {
+	err = bodyLimitExceeded(ctx, err)
+	var customStatus *runtime.HTTPStatusError
+	if errors.As(err, &customStatus) {
+		err = customStatus.Err
+	}
+	setErrorMetrics(ctx, err)
+	s := status.Convert(err)
+	message := s.Message()
+	if s.Code() == codes.Unavailable {
+		message = "inference server is unavailable: " + message
+	}
+	httpStatus := runtime.HTTPStatusFromCode(s.Code())
+	if customStatus != nil {
+		httpStatus = customStatus.HTTPStatus
+	}
+
+	w.Header().Del("Trailer")
+	w.Header().Del("Transfer-Encoding")
+	w.Header().Set("Content-Type", "application/json")
+	if s.Code() == codes.Unauthenticated {
+		w.Header().Set("WWW-Authenticate", s.Message())
+	}
+
+	forwardErrorResponseMetadata(ctx, w)
+
+	buf, merr := marshaler.Marshal(&ErrorResponse{Error: message})
+	if merr != nil {
+		logger.Error(merr, "Failed to marshal error response", "error", message)
+		w.WriteHeader(http.StatusInternalServerError)
+		_, _ = io.WriteString(w, `{"error":"failed to marshal error message"}`)
+		return
+	}
+	w.WriteHeader(httpStatus)
+	if _, err := w.Write(buf); err != nil {
+		logger.Error(err, "Failed to write error response")
+	}
+}
+
+// The gateway's default routing error handler reports a request using the
+// wrong HTTP method as Unimplemented, which errorHandler would return as 501.
+// This one keeps the 405 status and the message of the V2 REST protocol.
+func routingErrorHandler(ctx context.Context, mux *runtime.ServeMux, marshaler runtime.Marshaler,
+	w http.ResponseWriter, r *http.Request, httpStatus int) {
+	if httpStatus == http.StatusMethodNotAllowed {
+		errorHandler(ctx, mux, marshaler, w, r, &runtime.HTTPStatusError{
+			HTTPStatus: httpStatus,
+			Err:        status.Error(codes.Unimplemented, http.StatusText(httpStatus)),
+		})
+		return
+	}
+	runtime.DefaultRoutingErrorHandler(ctx, mux, marshaler, w, r, httpStatus)
+}
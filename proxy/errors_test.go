@@ -0,0 +1,101 @@
+/*
+Copyright 2021 IBM Corporation
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/grpc-ecosystem/grpc-gateway/v2/runtime"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	gw "github.com/kserve/rest-proxy/gen"
+)
+
+func TestErrorHandler(t *testing.T) {
+	mux := runtime.NewServeMux(runtime.WithErrorHandler(errorHandler))
+	marshaler := &CustomJSONPb{}
+	tests := []struct {
+		err          error
+		expected     int
+		expectedBody string
+	}{
+		{status.Error(codes.InvalidArgument, "bad input"), http.StatusBadRequest, `{"error":"bad input"}`},
+		{status.Error(codes.NotFound, "model not found"), http.StatusNotFound, `{"error":"model not found"}`},
+		{status.Error(codes.ResourceExhausted, "too many requests"), http.StatusTooManyRequests, `{"error":"too many requests"}`},
+		{status.Error(codes.Unavailable, "connection refused"), http.StatusServiceUnavailable, `{"error":"inference server is unavailable: connection refused"}`},
+		{errors.New("conversion failed"), http.StatusInternalServerError, `{"error":"conversion failed"}`},
+	}
+	for _, test := range tests {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest("POST", "/v2/models/example/infer", nil)
+		runtime.HTTPError(context.Background(), mux, marshaler, w, r, test.err)
+		if w.Code != test.expected {
+			t.Errorf("expected status %d for error %v, got %d", test.expected, test.err, w.Code)
+		}
+		if d := cmp.Diff(test.expectedBody, w.Body.String()); d != "" {
+			t.Errorf("diff :%s", d)
+		}
+	}
+}
+
+func TestRoutingErrors(t *testing.T) {
+	handler := newTestProxy(t, &testInferServer{}, nil, nil, nil)
+	tests := []struct {
+		method       string
+		path         string
+		expected     int
+		expectedBody string
+	}{
+		{"GET", "/v2/models/example/infer", http.StatusMethodNotAllowed, `{"error":"Method Not Allowed"}`},
+		{"POST", "/v2/unknown", http.StatusNotFound, `{"error":"Not Found"}`},
+	}
+	for _, test := range tests {
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, httptest.NewRequest(test.method, test.path, nil))
+		if w.Code != test.expected {
+			t.Errorf("expected status %d for %s %s, got %d", test.expected, test.method, test.path, w.Code)
+		}
+		if d := cmp.Diff(test.expectedBody, w.Body.String()); d != "" {
+			t.Errorf("diff :%s", d)
+		}
+	}
+}
+
+func TestResponseConversionError(t *testing.T) {
+	mux := runtime.NewServeMux(runtime.WithErrorHandler(errorHandler))
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest("POST", "/v2/models/example/infer", nil)
+	resp := &gw.ModelInferResponse{
+		Outputs: []*gw.ModelInferResponse_InferOutputTensor{{
+			Name: "predict", Datatype: "FP8", Shape: []int64{1}, Contents: &gw.InferTensorContents{},
+		}},
+	}
+	runtime.ForwardResponseMessage(context.Background(), mux, &CustomJSONPb{}, w, r, resp)
+	if w.Code != http.StatusInternalServerError {
+		t.Errorf("expected status 500, got %d", w.Code)
+	}
+	expected := `{"error":"` + unsupportedDatatypeError("FP8", "predict").Error() + `"}`
+	if d := cmp.Diff(expected, w.Body.String()); d != "" {
+		t.Errorf("diff :%s", d)
+	}
+}
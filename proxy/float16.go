@@ -0,0 +1,175 @@
+/*
+Copyright 2021 IBM Corporation
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+)
+
+// This file contains conversions between JSON numbers and the 16-bit floating point
+// formats FP16 (IEEE 754 binary16) and BF16 (bfloat16). The gRPC InferTensorContents
+// message has no fields for these, so they are always transferred as little-endian
+// raw bytes.
+//
+// Finite input values that overflow the format are rejected rather than turned
+// into infinities. JSON has no representation for non-finite numbers, so NaN and
+// infinite output values are returned as the strings "NaN", "Infinity" and
+// "-Infinity", as in the protobuf JSON mapping.
+
+type float16Format struct {
+	fromFloat64 func(float64) uint16
+	toFloat32   func(uint16) float32
+}
+
+var float16Formats = map[string]float16Format{
+	FP16: {float64ToHalf, halfToFloat32},
+	BF16: {float64ToBFloat16, bfloat16ToFloat32},
+}
+
+// Converts input tensor values to the little-endian raw bytes of a 16-bit float
+// datatype.
+func encode16BitFloats(dataType string, values []float64) ([]byte, error) {
+	format := float16Formats[dataType]
+	raw := make([]byte, 2*len(values))
+	for i, f := range values {
+		h := format.fromFloat64(f)
+		if math.IsInf(float64(format.toFloat32(h)), 0) && !math.IsInf(f, 0) {
+			return nil, fmt.Errorf("element %d overflows %s: %v", i, dataType, f)
+		}
+		binary.LittleEndian.PutUint16(raw[2*i:], h)
+	}
+	return raw, nil
+}
+
+// Decodes the little-endian raw bytes of a 16-bit float output tensor. The values
+// are returned as float32s unless some of them aren't finite, in which case those
+// are returned as strings.
+func decode16BitFloats(dataType, tensorName string, raw []byte, numElements int) (interface{}, error) {
+	if len(raw) != 2*numElements {
+		return nil, fmt.Errorf("raw contents of %s output tensor %s has %d bytes, expected %d",
+			dataType, tensorName, len(raw), 2*numElements)
+	}
+	format := float16Formats[dataType]
+	floats := make([]float32, numElements)
+	finite := true
+	for i := range floats {
+		floats[i] = format.toFloat32(binary.LittleEndian.Uint16(raw[2*i:]))
+		finite = finite && !math.IsInf(float64(floats[i]), 0) && !math.IsNaN(float64(floats[i]))
+	}
+	if finite {
+		return floats, nil
+	}
+	values := make([]interface{}, numElements)
+	for i, f := range floats {
+		switch {
+		case math.IsNaN(float64(f)):
+			values[i] = "NaN"
+		case math.IsInf(float64(f), 1):
+			values[i] = "Infinity"
+		case math.IsInf(float64(f), -1):
+			values[i] = "-Infinity"
+		default:
+			values[i] = f
+		}
+	}
+	return values, nil
+}
+
+// Converts a float64 to binary16 using round-to-nearest-even. Values whose
+// magnitude exceeds the largest finite half (65504) after rounding become +/-Inf,
+// values below the smallest subnormal (2^-24) round to signed zero, and NaN is
+// preserved as a quiet NaN.
+func float64ToHalf(f float64) uint16 {
+	return narrowFloat(f, 5, 10)
+}
+
+// Converts a float64 to bfloat16 using round-to-nearest-even. BF16 has the same
+// exponent range as FP32, so only values beyond ~3.39e38 overflow to +/-Inf, and
+// values below the smallest subnormal (2^-133) round to signed zero.
+func float64ToBFloat16(f float64) uint16 {
+	return narrowFloat(f, 8, 7)
+}
+
+// Rounds a float64 to a 16-bit float with the given number of exponent and
+// mantissa bits.
+func narrowFloat(f float64, expBits, mantBits int) uint16 {
+	bits := math.Float64bits(f)
+	sign := uint16(bits>>48) & 0x8000
+	exp := int(bits>>52) & 0x7ff
+	mant := bits & (1<<52 - 1)
+
+	maxExp := uint16(1)<<expBits - 1
+	inf := maxExp << mantBits
+	if exp == 0x7ff {
+		if mant != 0 {
+			return sign | inf | 1<<(mantBits-1) // NaN
+		}
+		return sign | inf
+	}
+	e := exp - 1023 + int(maxExp>>1) // rebias exponent
+	if e >= int(maxExp) {
+		return sign | inf // overflow
+	}
+	if e <= 0 {
+		if e < -mantBits {
+			return sign // underflow
+		}
+		// subnormal, include the implicit leading bit
+		return sign | uint16(roundShift(mant|1<<52, uint(53-mantBits-e)))
+	}
+	// a carry out of the mantissa correctly increments the exponent
+	return sign | (uint16(e)<<mantBits + uint16(roundShift(mant, uint(52-mantBits))))
+}
+
+// Shifts right by n bits, rounding to nearest with ties to even.
+func roundShift(m uint64, n uint) uint64 {
+	q := m >> n
+	rem := m & (1<<n - 1)
+	half := uint64(1) << (n - 1)
+	if rem > half || (rem == half && q&1 == 1) {
+		q++
+	}
+	return q
+}
+
+// Converts a binary16 value to float32, which represents every half value exactly.
+func halfToFloat32(h uint16) float32 {
+	sign := uint32(h&0x8000) << 16
+	exp := uint32(h>>10) & 0x1f
+	mant := uint32(h & 0x3ff)
+
+	switch exp {
+	case 0:
+		// zero or subnormal
+		v := float32(mant) / (1 << 24)
+		if sign != 0 {
+			v = -v
+		}
+		return v
+	case 0x1f:
+		// Inf or NaN
+		return math.Float32frombits(sign | 0x7f800000 | mant<<13)
+	}
+	return math.Float32frombits(sign | (exp-15+127)<<23 | mant<<13)
+}
+
+// Converts a bfloat16 value to float32, BF16 is the upper half of an FP32 value.
+func bfloat16ToFloat32(b uint16) float32 {
+	return math.Float32frombits(uint32(b) << 16)
+}
@@ -0,0 +1,112 @@
+/*
+Copyright 2021 IBM Corporation
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"math"
+	"testing"
+)
+
+func TestFloat64ToHalf(t *testing.T) {
+	tests := []struct {
+		value    float64
+		expected uint16
+	}{
+		{0, 0x0000},
+		{math.Copysign(0, -1), 0x8000},
+		{1, 0x3c00},
+		{-2, 0xc000},
+		{0.1, 0x2e66},
+		{1.0 / 3, 0x3555},
+		{1 + 1.0/1024, 0x3c01},
+		{1 + 1.0/2048, 0x3c00}, // tie rounds to even
+		{1 + 3.0/2048, 0x3c02}, // tie rounds to even
+		{65504, 0x7bff},        // max finite
+		{65519, 0x7bff},
+		{65520, 0x7c00}, // overflows to Inf
+		{1e6, 0x7c00},
+		{-1e6, 0xfc00},
+		{math.Inf(1), 0x7c00},
+		{math.NaN(), 0x7e00},
+		{math.Ldexp(1, -14), 0x0400}, // min normal
+		{math.Ldexp(1, -24), 0x0001}, // min subnormal
+		{math.Ldexp(1, -25), 0x0000}, // tie rounds to even
+		{math.Ldexp(1.5, -25), 0x0001},
+		{math.Ldexp(1, -30), 0x0000},
+		{-math.Ldexp(1, -30), 0x8000},
+	}
+	for _, test := range tests {
+		if h := float64ToHalf(test.value); h != test.expected {
+			t.Errorf("float64ToHalf(%v) = %#04x, expected %#04x", test.value, h, test.expected)
+		}
+	}
+}
+
+func TestFloat64ToBFloat16(t *testing.T) {
+	tests := []struct {
+		value    float64
+		expected uint16
+	}{
+		{0, 0x0000},
+		{1, 0x3f80},
+		{-2, 0xc000},
+		{0.1, 0x3dcd},
+		{1 + 1.0/256, 0x3f80},           // tie rounds to even
+		{1 + 3.0/256, 0x3f82},           // tie rounds to even
+		{3.3895313892515355e38, 0x7f7f}, // max finite
+		{3.4e38, 0x7f80},                // overflows to Inf
+		{-1e39, 0xff80},
+		{math.NaN(), 0x7fc0},
+		{math.Ldexp(1, -126), 0x0080}, // min normal
+		{math.Ldexp(1, -133), 0x0001}, // min subnormal
+		{math.Ldexp(1, -134), 0x0000}, // tie rounds to even
+	}
+	for _, test := range tests {
+		if b := float64ToBFloat16(test.value); b != test.expected {
+			t.Errorf("float64ToBFloat16(%v) = %#04x, expected %#04x", test.value, b, test.expected)
+		}
+	}
+}
+
+func TestHalfRoundTrip(t *testing.T) {
+	for i := 0; i <= math.MaxUint16; i++ {
+		h := uint16(i)
+		f := halfToFloat32(h)
+		if math.IsNaN(float64(f)) {
+			if h&0x7c00 != 0x7c00 || h&0x3ff == 0 {
+				t.Errorf("unexpected NaN for %#04x", h)
+			}
+			continue
+		}
+		if r := float64ToHalf(float64(f)); r != h {
+			t.Errorf("round trip of %#04x via %v returned %#04x", h, f, r)
+		}
+	}
+}
+
+func TestBFloat16RoundTrip(t *testing.T) {
+	for i := 0; i <= math.MaxUint16; i++ {
+		b := uint16(i)
+		f := bfloat16ToFloat32(b)
+		if math.IsNaN(float64(f)) {
+			continue
+		}
+		if r := float64ToBFloat16(float64(f)); r != b {
+			t.Errorf("round trip of %#04x via %v returned %#04x", b, f, r)
+		}
+	}
+}
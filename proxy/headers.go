@@ -0,0 +1,143 @@
+/*
+Copyright 2021 IBM Corporation
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"context"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/grpc-ecosystem/grpc-gateway/v2/runtime"
+	"google.golang.org/protobuf/proto"
+)
+
+const (
+	requestHeadersEnvVar         = "REST_PROXY_FORWARD_REQUEST_HEADERS"
+	requestHeaderPrefixesEnvVar  = "REST_PROXY_FORWARD_REQUEST_HEADER_PREFIXES"
+	responseHeadersEnvVar        = "REST_PROXY_FORWARD_RESPONSE_HEADERS"
+	responseHeaderPrefixesEnvVar = "REST_PROXY_FORWARD_RESPONSE_HEADER_PREFIXES"
+)
+
+// Plain HTTP headers forwarded to the gRPC server as metadata, in addition to
+// the Grpc-Metadata- prefixed headers forwarded by default, and gRPC response
+// metadata returned as plain HTTP headers rather than Grpc-Metadata- prefixed.
+var (
+	requestHeaderRules  = headerRules{names: map[string]bool{"mm-vmodel-id": true, "mm-model-id": true, "mm-balanced": true}}
+	responseHeaderRules = headerRules{}
+)
+
+// A set of header names and name prefixes, matched case-insensitively.
+type headerRules struct {
+	names    map[string]bool
+	prefixes []string
+}
+
+// Parses comma-separated lists of header names and prefixes.
+func parseHeaderRules(names, prefixes string) headerRules {
+	rules := headerRules{names: make(map[string]bool)}
+	for _, name := range strings.Split(names, ",") {
+		if name = strings.ToLower(strings.TrimSpace(name)); name != "" {
+			rules.names[name] = true
+		}
+	}
+	for _, prefix := range strings.Split(prefixes, ",") {
+		if prefix = strings.ToLower(strings.TrimSpace(prefix)); prefix != "" {
+			rules.prefixes = append(rules.prefixes, prefix)
+		}
+	}
+	return rules
+}
+
+// Replaces the given rules if either of the environment variables is set.
+func getHeaderRulesEnv(rules *headerRules, namesEnvVar, prefixesEnvVar string) {
+	names, namesSet := os.LookupEnv(namesEnvVar)
+	prefixes, prefixesSet := os.LookupEnv(prefixesEnvVar)
+	if namesSet || prefixesSet {
+		*rules = parseHeaderRules(names, prefixes)
+	}
+}
+
+func (h headerRules) matches(key string) bool {
+	key = strings.ToLower(key)
+	if h.names[key] {
+		return true
+	}
+	for _, prefix := range h.prefixes {
+		if strings.HasPrefix(key, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// Forwards the configured request headers as lowercase gRPC metadata keys, in
+// addition to the headers forwarded by the gateway's default matcher, except for
+// any attempt by REST clients to set the client certificate subject themselves.
+func incomingHeaderMatcher(key string) (string, bool) {
+	if strings.EqualFold(key, CLIENT_CERT_SUBJECT) || strings.EqualFold(key, runtime.MetadataHeaderPrefix+CLIENT_CERT_SUBJECT) {
+		return "", false
+	}
+	if requestHeaderRules.matches(key) {
+		return strings.ToLower(key), true
+	}
+	return runtime.DefaultHeaderMatcher(key)
+}
+
+// Returns the configured response metadata as plain HTTP headers, and any other
+// metadata with the Grpc-Metadata- prefix as the gateway does by default.
+func outgoingHeaderMatcher(key string) (string, bool) {
+	if responseHeaderRules.matches(key) {
+		return key, true
+	}
+	return runtime.MetadataHeaderPrefix + key, true
+}
+
+// This function is registered as a forward response option to return the
+// configured response trailers as HTTP headers. The gateway only forwards
+// trailers as Grpc-Trailer- prefixed HTTP trailers when the client accepts them.
+func forwardResponseTrailers(ctx context.Context, w http.ResponseWriter, _ proto.Message) error {
+	md, ok := runtime.ServerMetadataFromContext(ctx)
+	if !ok {
+		return nil
+	}
+	for k, vs := range md.TrailerMD {
+		if responseHeaderRules.matches(k) {
+			for _, v := range vs {
+				w.Header().Add(k, v)
+			}
+		}
+	}
+	return nil
+}
+
+// Forwards the response metadata for error responses, which don't go through
+// the forward response options.
+func forwardErrorResponseMetadata(ctx context.Context, w http.ResponseWriter) {
+	md, ok := runtime.ServerMetadataFromContext(ctx)
+	if !ok {
+		return
+	}
+	for k, vs := range md.HeaderMD {
+		if h, ok := outgoingHeaderMatcher(k); ok {
+			for _, v := range vs {
+				w.Header().Add(h, v)
+			}
+		}
+	}
+	_ = forwardResponseTrailers(ctx, w, nil)
+}
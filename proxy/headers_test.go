@@ -0,0 +1,108 @@
+/*
+Copyright 2021 IBM Corporation
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/grpc-ecosystem/grpc-gateway/v2/runtime"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+func withHeaderRules(t *testing.T, request, response headerRules) {
+	req, resp := requestHeaderRules, responseHeaderRules
+	t.Cleanup(func() { requestHeaderRules, responseHeaderRules = req, resp })
+	requestHeaderRules, responseHeaderRules = request, response
+}
+
+func TestIncomingHeaderMatcher(t *testing.T) {
+	withHeaderRules(t, parseHeaderRules("mm-vmodel-id, MM-Balanced", "x-route-"), headerRules{})
+	tests := []struct {
+		header   string
+		expected string
+		ok       bool
+	}{
+		{"Mm-Vmodel-Id", "mm-vmodel-id", true},
+		{"Mm-Balanced", "mm-balanced", true},
+		{"X-Route-Zone", "x-route-zone", true},
+		{"Grpc-Metadata-Foo", "Foo", true},
+		{"Authorization", "grpcgateway-Authorization", true},
+		{"Mm-Model-Id", "", false},
+		{"Grpc-Metadata-Rest-Proxy-Client-Cert-Subject", "", false},
+		{"Rest-Proxy-Client-Cert-Subject", "", false},
+	}
+	for _, test := range tests {
+		key, ok := incomingHeaderMatcher(test.header)
+		if key != test.expected || ok != test.ok {
+			t.Errorf("expected %s to be forwarded as %q (%t), got %q (%t)", test.header, test.expected, test.ok, key, ok)
+		}
+	}
+}
+
+func TestDefaultRequestHeaderRules(t *testing.T) {
+	for _, header := range []string{"Mm-Vmodel-Id", "Mm-Model-Id", "Mm-Balanced"} {
+		if key, ok := incomingHeaderMatcher(header); !ok || key == header {
+			t.Errorf("expected %s to be forwarded by default", header)
+		}
+	}
+}
+
+func TestResponseHeaderForwarding(t *testing.T) {
+	withHeaderRules(t, headerRules{}, parseHeaderRules("mm-model-id", "x-served-"))
+	for key, expected := range map[string]string{
+		"mm-model-id":    "mm-model-id",
+		"x-served-by":    "x-served-by",
+		"other-metadata": "Grpc-Metadata-other-metadata",
+	} {
+		if h, ok := outgoingHeaderMatcher(key); !ok || h != expected {
+			t.Errorf("expected metadata %s to be returned as %s, got %s", key, expected, h)
+		}
+	}
+
+	ctx := runtime.NewServerMetadataContext(context.Background(), runtime.ServerMetadata{
+		HeaderMD:  metadata.Pairs("mm-model-id", "model-1", "other-metadata", "foo"),
+		TrailerMD: metadata.Pairs("x-served-by", "pod-1", "other-trailer", "bar"),
+	})
+	w := httptest.NewRecorder()
+	if err := forwardResponseTrailers(ctx, w, nil); err != nil {
+		t.Fatal(err)
+	}
+	if d := cmp.Diff(http.Header{"X-Served-By": {"pod-1"}}, w.Header()); d != "" {
+		t.Errorf("diff :%s", d)
+	}
+
+	// error responses
+	mux := runtime.NewServeMux(runtime.WithErrorHandler(errorHandler))
+	w = httptest.NewRecorder()
+	r := httptest.NewRequest("POST", "/v2/models/example/infer", nil)
+	runtime.HTTPError(ctx, mux, &CustomJSONPb{}, w, r, status.Error(codes.NotFound, "model not found"))
+	expected := http.Header{
+		"Content-Type":                 {"application/json"},
+		"Mm-Model-Id":                  {"model-1"},
+		"Grpc-Metadata-Other-Metadata": {"foo"},
+		"X-Served-By":                  {"pod-1"},
+	}
+	if d := cmp.Diff(expected, w.Header()); d != "" {
+		t.Errorf("diff :%s", d)
+	}
+}
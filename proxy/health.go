@@ -0,0 +1,158 @@
+/*
+Copyright 2021 IBM Corporation
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"sync/atomic"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/connectivity"
+	"google.golang.org/protobuf/proto"
+
+	gw "github.com/kserve/rest-proxy/gen"
+)
+
+const (
+	HEALTHZ_PATH = "/healthz"
+	READYZ_PATH  = "/readyz"
+
+	readyzServerReadyEnvVar = "REST_PROXY_READYZ_CHECK_SERVER_READY"
+	readyzTimeout           = 2 * time.Second
+)
+
+type LiveResponse struct {
+	Live bool `json:"live"`
+}
+
+type ReadyResponse struct {
+	Ready bool `json:"ready"`
+}
+
+// This function is registered as a forward response option so that a negative
+// server or model readiness result is returned with HTTP 503, allowing the
+// endpoints to be used directly as Kubernetes probes and rollout checks.
+func healthResponseStatus(_ context.Context, w http.ResponseWriter, m proto.Message) error {
+	var healthy bool
+	switch r := m.(type) {
+	case *gw.ServerLiveResponse:
+		healthy = r.Live
+	case *gw.ServerReadyResponse:
+		healthy = r.Ready
+	case *gw.ModelReadyResponse:
+		healthy = r.Ready
+	default:
+		return nil
+	}
+	if !healthy {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+	return nil
+}
+
+type ProbeResponse struct {
+	Ready        bool   `json:"ready"`
+	BackendState string `json:"backend_state"`
+	Error        string `json:"error,omitempty"`
+}
+
+// Reports the readiness of the proxy based on the state of its gRPC connection
+// to the inference server, and optionally the server's own readiness.
+type backendProbe struct {
+	conn             *grpc.ClientConn
+	client           gw.GRPCInferenceServiceClient
+	checkServerReady bool
+	shuttingDown     atomic.Bool
+}
+
+func newBackendProbe(conn *grpc.ClientConn, checkServerReady bool) *backendProbe {
+	return &backendProbe{conn: conn, client: gw.NewGRPCInferenceServiceClient(conn), checkServerReady: checkServerReady}
+}
+
+func (p *backendProbe) ready(ctx context.Context) *ProbeResponse {
+	state := p.conn.GetState()
+	resp := &ProbeResponse{BackendState: state.String()}
+	if p.shuttingDown.Load() {
+		resp.Error = "REST proxy is shutting down"
+		return resp
+	}
+	if state != connectivity.Ready {
+		if state == connectivity.Idle {
+			p.conn.Connect()
+		}
+		resp.Error = "gRPC connection to the inference server is not ready"
+		return resp
+	}
+	if p.checkServerReady {
+		ctx, cancel := context.WithTimeout(ctx, readyzTimeout)
+		defer cancel()
+		sr, err := p.client.ServerReady(ctx, &gw.ServerReadyRequest{})
+		if err != nil {
+			resp.Error = "inference server readiness check failed: " + err.Error()
+			return resp
+		}
+		if !sr.Ready {
+			resp.Error = "inference server is not ready"
+			return resp
+		}
+	}
+	resp.Ready = true
+	return resp
+}
+
+// This handler serves the proxy's own liveness and readiness probes, which
+// unlike the V2 health endpoints don't depend on the inference server being
+// reachable, and passes all other requests on.
+func probeHandler(probe *backendProbe, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case HEALTHZ_PATH:
+			writeProbeResponse(w, http.StatusOK, &LiveResponse{Live: true})
+		case READYZ_PATH:
+			resp := probe.ready(r.Context())
+			code := http.StatusOK
+			if !resp.Ready {
+				code = http.StatusServiceUnavailable
+			}
+			writeProbeResponse(w, code, resp)
+		default:
+			next.ServeHTTP(w, r)
+		}
+	})
+}
+
+func writeProbeResponse(w http.ResponseWriter, code int, resp interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	if err := json.NewEncoder(w).Encode(resp); err != nil {
+		logger.Error(err, "Failed to write probe response")
+	}
+}
+
+// Logs the changes of the gRPC connection state until the context is cancelled,
+// so that restarts of the inference server are visible in the proxy logs.
+func logConnectivityState(ctx context.Context, conn *grpc.ClientConn) {
+	state := conn.GetState()
+	for conn.WaitForStateChange(ctx, state) {
+		prev := state
+		state = conn.GetState()
+		logger.Info("gRPC connection state changed", "from", prev.String(), "to", state.String())
+	}
+}
@@ -0,0 +1,186 @@
+/*
+Copyright 2021 IBM Corporation
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/connectivity"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/protobuf/proto"
+
+	gw "github.com/kserve/rest-proxy/gen"
+)
+
+func TestHealthResponseStatus(t *testing.T) {
+	tests := []struct {
+		resp     proto.Message
+		expected int
+	}{
+		{&gw.ServerLiveResponse{Live: true}, http.StatusOK},
+		{&gw.ServerLiveResponse{}, http.StatusServiceUnavailable},
+		{&gw.ServerReadyResponse{Ready: true}, http.StatusOK},
+		{&gw.ServerReadyResponse{}, http.StatusServiceUnavailable},
+		{&gw.ModelReadyResponse{Ready: true}, http.StatusOK},
+		{&gw.ModelReadyResponse{}, http.StatusServiceUnavailable},
+		{&gw.ModelInferResponse{}, http.StatusOK},
+	}
+	for _, test := range tests {
+		w := httptest.NewRecorder()
+		if err := healthResponseStatus(context.Background(), w, test.resp); err != nil {
+			t.Error(err)
+		}
+		if w.Code != test.expected {
+			t.Errorf("expected status %d for %T, got %d", test.expected, test.resp, w.Code)
+		}
+	}
+}
+
+type testInferenceServer struct {
+	gw.UnimplementedGRPCInferenceServiceServer
+	ready atomic.Bool
+}
+
+func (s *testInferenceServer) ServerReady(context.Context, *gw.ServerReadyRequest) (*gw.ServerReadyResponse, error) {
+	return &gw.ServerReadyResponse{Ready: s.ready.Load()}, nil
+}
+
+// Starts a gRPC server on a local port, returning its address.
+func startTestGrpcServer(t *testing.T, srv gw.GRPCInferenceServiceServer) string {
+	t.Helper()
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := grpc.NewServer()
+	gw.RegisterGRPCInferenceServiceServer(s, srv)
+	go s.Serve(lis)
+	t.Cleanup(s.Stop)
+	return lis.Addr().String()
+}
+
+func dialTestGrpcServer(t *testing.T, target string) *grpc.ClientConn {
+	t.Helper()
+	conn, err := grpc.Dial(target, grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return conn
+}
+
+func waitForState(t *testing.T, conn *grpc.ClientConn, state connectivity.State) {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	conn.Connect()
+	for s := conn.GetState(); s != state; s = conn.GetState() {
+		if !conn.WaitForStateChange(ctx, s) {
+			t.Fatalf("timed out waiting for gRPC connection state %s, got %s", state, s)
+		}
+	}
+}
+
+func TestProbeHandler(t *testing.T) {
+	srv := &testInferenceServer{}
+	conn := dialTestGrpcServer(t, startTestGrpcServer(t, srv))
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(http.StatusTeapot) })
+
+	tests := []struct {
+		name             string
+		path             string
+		checkServerReady bool
+		serverReady      bool
+		expected         int
+		expectedBody     string
+	}{
+		{"liveness", "/healthz", false, false, http.StatusOK, `{"live":true}`},
+		{"ready", "/readyz", false, false, http.StatusOK, `{"ready":true,"backend_state":"READY"}`},
+		{"server not ready", "/readyz", true, false, http.StatusServiceUnavailable,
+			`{"ready":false,"backend_state":"READY","error":"inference server is not ready"}`},
+		{"server ready", "/readyz", true, true, http.StatusOK, `{"ready":true,"backend_state":"READY"}`},
+		{"other paths", "/v2/health/ready", false, false, http.StatusTeapot, ""},
+	}
+	waitForState(t, conn, connectivity.Ready)
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			srv.ready.Store(test.serverReady)
+			w := httptest.NewRecorder()
+			probeHandler(newBackendProbe(conn, test.checkServerReady), next).ServeHTTP(w, httptest.NewRequest("GET", test.path, nil))
+			if w.Code != test.expected {
+				t.Errorf("expected status %d, got %d", test.expected, w.Code)
+			}
+			if test.expectedBody != "" {
+				if d := cmp.Diff(test.expectedBody+"\n", w.Body.String()); d != "" {
+					t.Errorf("diff :%s", d)
+				}
+			}
+		})
+	}
+}
+
+func TestProbeHandlerShuttingDown(t *testing.T) {
+	conn := dialTestGrpcServer(t, startTestGrpcServer(t, &testInferenceServer{}))
+	waitForState(t, conn, connectivity.Ready)
+	probe := newBackendProbe(conn, false)
+	probe.shuttingDown.Store(true)
+
+	w := httptest.NewRecorder()
+	probeHandler(probe, nil).ServeHTTP(w, httptest.NewRequest("GET", "/readyz", nil))
+	if w.Code != http.StatusServiceUnavailable {
+		t.Errorf("expected status 503, got %d", w.Code)
+	}
+	expected := `{"ready":false,"backend_state":"READY","error":"REST proxy is shutting down"}` + "\n"
+	if d := cmp.Diff(expected, w.Body.String()); d != "" {
+		t.Errorf("diff :%s", d)
+	}
+}
+
+func TestProbeHandlerBackendUnavailable(t *testing.T) {
+	// nothing is listening on the port once the listener is closed
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	lis.Close()
+	conn := dialTestGrpcServer(t, lis.Addr().String())
+	waitForState(t, conn, connectivity.TransientFailure)
+
+	w := httptest.NewRecorder()
+	probeHandler(newBackendProbe(conn, false), nil).ServeHTTP(w, httptest.NewRequest("GET", "/readyz", nil))
+	if w.Code != http.StatusServiceUnavailable {
+		t.Errorf("expected status 503, got %d", w.Code)
+	}
+	expected := `{"ready":false,"backend_state":"TRANSIENT_FAILURE","error":"gRPC connection to the inference server is not ready"}` + "\n"
+	if d := cmp.Diff(expected, w.Body.String()); d != "" {
+		t.Errorf("diff :%s", d)
+	}
+
+	w = httptest.NewRecorder()
+	probeHandler(newBackendProbe(conn, false), nil).ServeHTTP(w, httptest.NewRequest("GET", "/healthz", nil))
+	if w.Code != http.StatusOK {
+		t.Errorf("expected liveness to succeed, got %d", w.Code)
+	}
+}
@@ -0,0 +1,196 @@
+/*
+Copyright 2021 IBM Corporation
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+
+	"github.com/grpc-ecosystem/grpc-gateway/v2/runtime"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// This file contains the limits protecting the proxy from requests that would
+// need too much memory to decode. A limit of 0 disables the check, the limits
+// are disabled by default so that no previously accepted request is rejected.
+
+const (
+	maxRequestBodyBytesEnvVar = "REST_PROXY_MAX_REQUEST_BODY_BYTES"
+	maxTensorElementsEnvVar   = "REST_PROXY_MAX_TENSOR_ELEMENTS"
+	maxRequestElementsEnvVar  = "REST_PROXY_MAX_REQUEST_ELEMENTS"
+	maxInputsEnvVar           = "REST_PROXY_MAX_INPUTS"
+	maxJSONDepthEnvVar        = "REST_PROXY_MAX_JSON_DEPTH"
+)
+
+var (
+	maxRequestBodyBytes = 0
+	maxTensorElements   = 0
+	maxRequestElements  = 0
+	maxInputs           = 0
+	maxJSONDepth        = 0
+)
+
+func getLimitsEnv() {
+	maxRequestBodyBytes = getIntegerEnv(maxRequestBodyBytesEnvVar, maxRequestBodyBytes)
+	maxTensorElements = getIntegerEnv(maxTensorElementsEnvVar, maxTensorElements)
+	maxRequestElements = getIntegerEnv(maxRequestElementsEnvVar, maxRequestElements)
+	maxInputs = getIntegerEnv(maxInputsEnvVar, maxInputs)
+	maxJSONDepth = getIntegerEnv(maxJSONDepthEnvVar, maxJSONDepth)
+}
+
+// The body of a request, limited to maxRequestBodyBytes. Whether the limit was
+// exceeded is recorded so that errorHandler can return 413 instead of the 400
+// the gateway returns for decoding errors.
+type limitedBody struct {
+	io.ReadCloser
+	exceeded bool
+}
+
+type limitedBodyKey struct{}
+
+func (b *limitedBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	var maxBytesErr *http.MaxBytesError
+	if errors.As(err, &maxBytesErr) {
+		b.exceeded = true
+	}
+	return n, err
+}
+
+// This handler limits the size of request bodies, rejecting requests whose
+// Content-Length exceeds the limit before their body is read.
+func bodyLimitHandler(mux *runtime.ServeMux, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if maxRequestBodyBytes <= 0 {
+			next.ServeHTTP(w, r)
+			return
+		}
+		if r.ContentLength > int64(maxRequestBodyBytes) {
+			_, outboundMarshaler := runtime.MarshalerForRequest(mux, r)
+			runtime.HTTPError(r.Context(), mux, outboundMarshaler, w, r, bodyLimitError())
+			return
+		}
+		body := &limitedBody{ReadCloser: http.MaxBytesReader(w, r.Body, int64(maxRequestBodyBytes))}
+		r.Body = body
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), limitedBodyKey{}, body)))
+	})
+}
+
+func bodyLimitError() error {
+	return &runtime.HTTPStatusError{
+		HTTPStatus: http.StatusRequestEntityTooLarge,
+		Err: status.Errorf(codes.InvalidArgument, "request body exceeds the limit of %d bytes",
+			maxRequestBodyBytes),
+	}
+}
+
+// Returns the error to return instead of err if the request body exceeded the
+// limit while it was read.
+func bodyLimitExceeded(ctx context.Context, err error) error {
+	if body, _ := ctx.Value(limitedBodyKey{}).(*limitedBody); body != nil && body.exceeded {
+		return bodyLimitError()
+	}
+	return err
+}
+
+// Returns the number of elements of a tensor of the given shape, checking the
+// shape and the limit on the number of elements of a tensor.
+func checkTensorElements(tensorName string, shape []int64) (int64, error) {
+	count := int64(1)
+	for i, dim := range shape {
+		if dim < 0 {
+			return 0, fmt.Errorf("dimension %d of input tensor %s is negative: %d", i, tensorName, dim)
+		}
+		if dim != 0 && count > math.MaxInt64/dim {
+			count = math.MaxInt64 // saturate rather than overflow, exceeding any limit
+		} else {
+			count *= dim
+		}
+	}
+	if maxTensorElements > 0 && count > int64(maxTensorElements) {
+		return 0, fmt.Errorf("input tensor %s has %s elements, exceeding the limit of %d",
+			tensorName, elementCountString(count), maxTensorElements)
+	}
+	return count, nil
+}
+
+func elementCountString(count int64) string {
+	if count == math.MaxInt64 {
+		return "more than " + fmt.Sprint(int64(math.MaxInt64))
+	}
+	return fmt.Sprint(count)
+}
+
+// Adds the elements of a tensor to the number of elements of a request,
+// checking the limit on the number of elements of a request.
+func addRequestElements(total *int64, count int64) error {
+	if *total += count; *total < 0 {
+		*total = math.MaxInt64
+	}
+	return checkRequestElements(*total)
+}
+
+func checkRequestElements(count int64) error {
+	if maxRequestElements > 0 && count > int64(maxRequestElements) {
+		return fmt.Errorf("request has %s tensor elements, exceeding the limit of %d",
+			elementCountString(count), maxRequestElements)
+	}
+	return nil
+}
+
+func checkInputCount(count int) error {
+	if maxInputs > 0 && count > maxInputs {
+		return fmt.Errorf("request has %d input tensors, exceeding the limit of %d", count, maxInputs)
+	}
+	return nil
+}
+
+// Checks that the nesting depth of the arrays and objects of a JSON value
+// doesn't exceed the limit.
+func checkJSONDepth(data []byte) error {
+	if maxJSONDepth <= 0 {
+		return nil
+	}
+	depth := 0
+	inString, escaped := false, false
+	for _, b := range data {
+		switch {
+		case inString:
+			if escaped {
+				escaped = false
+			} else if b == '\\' {
+				escaped = true
+			} else if b == '"' {
+				inString = false
+			}
+		case b == '"':
+			inString = true
+		case b == '[' || b == '{':
+			if depth++; depth > maxJSONDepth {
+				return fmt.Errorf("request JSON nesting depth exceeds the limit of %d", maxJSONDepth)
+			}
+		case b == ']' || b == '}':
+			depth--
+		}
+	}
+	return nil
+}
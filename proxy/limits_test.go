@@ -0,0 +1,103 @@
+/*
+Copyright 2021 IBM Corporation
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func withLimits(t *testing.T, bodyBytes, tensorElements, requestElements, inputs, depth int) {
+	t.Helper()
+	prev := []int{maxRequestBodyBytes, maxTensorElements, maxRequestElements, maxInputs, maxJSONDepth}
+	maxRequestBodyBytes, maxTensorElements, maxRequestElements, maxInputs, maxJSONDepth =
+		bodyBytes, tensorElements, requestElements, inputs, depth
+	t.Cleanup(func() {
+		maxRequestBodyBytes, maxTensorElements, maxRequestElements, maxInputs, maxJSONDepth =
+			prev[0], prev[1], prev[2], prev[3], prev[4]
+	})
+}
+
+func TestRequestLimits(t *testing.T) {
+	withLimits(t, 512, 8, 10, 2, 5)
+	handler := newTestProxy(t, &testInferServer{}, nil, nil, nil)
+	tensor := func(name, shape, data string) string {
+		return `{"name":"` + name + `","datatype":"FP32","shape":` + shape + `,"data":` + data + `}`
+	}
+	large := `{"inputs":[` + tensor("input", "[1]", "[1.5]") + `],"parameters":{"pad":"` + strings.Repeat("x", 512) + `"}}`
+
+	tests := []struct {
+		name     string
+		body     string
+		chunked  bool
+		status   int
+		expected string
+	}{
+		{"within the limits", `{"inputs":[` + tensor("a", "[2,4]", "[[1,2,3,4],[5,6,7,8]]") + `,` + tensor("b", "[2]", "[1,2]") + `]}`,
+			false, http.StatusOK, ""},
+		{"body with content length", large, false, http.StatusRequestEntityTooLarge,
+			`{"error":"request body exceeds the limit of 512 bytes"}`},
+		{"chunked body", large, true, http.StatusRequestEntityTooLarge,
+			`{"error":"request body exceeds the limit of 512 bytes"}`},
+		{"tensor elements", `{"inputs":[` + tensor("input", "[1000000,1000000]", "[1.5]") + `]}`, false, http.StatusBadRequest,
+			`{"error":"input tensor input has 1000000000000 elements, exceeding the limit of 8"}`},
+		{"overflowing shape", `{"inputs":[` + tensor("input", "[9223372036854775807,2]", "[1.5]") + `]}`, false, http.StatusBadRequest,
+			`{"error":"input tensor input has more than 9223372036854775807 elements, exceeding the limit of 8"}`},
+		{"negative dimension", `{"inputs":[` + tensor("input", "[2,-1]", "[1.5]") + `]}`, false, http.StatusBadRequest,
+			`{"error":"dimension 1 of input tensor input is negative: -1"}`},
+		{"request elements", `{"inputs":[` + tensor("a", "[8]", "[1,2,3,4,5,6,7,8]") + `,` + tensor("b", "[3]", "[1,2,3]") + `]}`,
+			false, http.StatusBadRequest, `{"error":"request has 11 tensor elements, exceeding the limit of 10"}`},
+		{"inputs", `{"inputs":[` + tensor("a", "[1]", "[1]") + `,` + tensor("b", "[1]", "[1]") + `,` + tensor("c", "[1]", "[1]") + `]}`,
+			false, http.StatusBadRequest, `{"error":"request has 3 input tensors, exceeding the limit of 2"}`},
+		{"nesting depth", `{"inputs":[` + tensor("input", "[1,1,1]", "[[[1]]]") + `]}`, false, http.StatusBadRequest,
+			`{"error":"request JSON nesting depth exceeds the limit of 5"}`},
+		{"brackets in strings", `{"id":"[[[[[[","inputs":[` + tensor("input", "[1]", "[1]") + `]}`, false, http.StatusOK, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var body io.Reader = strings.NewReader(tt.body)
+			if tt.chunked {
+				body = io.MultiReader(body) // hides the length of the body
+			}
+			r := httptest.NewRequest("POST", "/v2/models/example/infer", body)
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, r)
+			if w.Code != tt.status {
+				t.Errorf("expected status %d, got %d: %s", tt.status, w.Code, w.Body.String())
+			}
+			if tt.expected != "" && w.Body.String() != tt.expected {
+				t.Errorf("expected body %s, got %s", tt.expected, w.Body.String())
+			}
+		})
+	}
+}
+
+func TestInferenceHeaderLengthLimit(t *testing.T) {
+	withLimits(t, 512, 8, 10, 2, 5)
+	handler := newTestProxy(t, &testInferServer{}, nil, nil, nil)
+	r := httptest.NewRequest("POST", "/v2/models/example/infer", strings.NewReader(inferRequestBody))
+	r.Header.Set(INFERENCE_HEADER_CONTENT_LENGTH, "1000000000000")
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, r)
+	expected := `{"error":"Inference-Header-Content-Length 1000000000000 exceeds the request body limit of 512 bytes"}`
+	if w.Code != http.StatusBadRequest || w.Body.String() != expected {
+		t.Errorf("expected status 400 and body %s, got %d and %s", expected, w.Code, w.Body.String())
+	}
+}
@@ -18,11 +18,13 @@ package main
 
 import (
 	"context"
-	"crypto/tls"
 	"fmt"
 	"net/http"
 	"os"
+	"os/signal"
 	"strconv"
+	"syscall"
+	"time"
 
 	"github.com/grpc-ecosystem/grpc-gateway/v2/runtime"
 	"google.golang.org/grpc"
@@ -37,10 +39,12 @@ const (
 	restProxyPortEnvVar       = "REST_PROXY_LISTEN_PORT"
 	restProxyGrpcMaxMsgSize   = "REST_PROXY_GRPC_MAX_MSG_SIZE_BYTES"
 	restProxyGrpcPortEnvVar   = "REST_PROXY_GRPC_PORT"
+	restProxyGrpcTargetEnvVar = "REST_PROXY_GRPC_TARGET"
 	restProxyTlsEnvVar        = "REST_PROXY_USE_TLS"
 	restProxySkipVerifyEnvVar = "REST_PROXY_SKIP_VERIFY"
 	tlsCertEnvVar             = "MM_TLS_KEY_CERT_PATH"
 	tlsKeyEnvVar              = "MM_TLS_PRIVATE_KEY_PATH"
+	tlsReloadIntervalEnvVar   = "REST_PROXY_TLS_RELOAD_INTERVAL"
 )
 
 var (
@@ -51,6 +55,10 @@ var (
 	inferenceServicePort    = 8033
 	listenPort              = 8008
 	maxGrpcMessageSizeBytes = 16777216
+	tlsReloadInterval       = 30 * time.Second
+	shutdownDelay           = time.Duration(0)
+	shutdownTimeout         = 30 * time.Second
+	accessLogSampleRate     = 1.0
 )
 
 func getIntegerEnv(envVar string, defaultValue int) int {
@@ -65,71 +73,218 @@ func getIntegerEnv(envVar string, defaultValue int) int {
 	return defaultValue
 }
 
+// Returns the gRPC dial target of the inference server. This is either a
+// host:port address or a URI such as dns:///host:port or unix:///path/to/socket,
+// defaulting to localhost and the port set by REST_PROXY_GRPC_PORT.
+func getGrpcTarget() string {
+	if target, ok := os.LookupEnv(restProxyGrpcTargetEnvVar); ok && target != "" {
+		return target
+	}
+	port := getIntegerEnv(restProxyGrpcPortEnvVar, inferenceServicePort)
+	return fmt.Sprintf("%s:%d", grpcServerEndpoint, port)
+}
+
+func getBoolEnv(envVar string, defaultValue bool) bool {
+	if val, ok := os.LookupEnv(envVar); ok {
+		val, err := strconv.ParseBool(val)
+		if err != nil {
+			logger.Error(err, "unable to parse environment variable", "env", envVar)
+			os.Exit(1)
+		}
+		return val
+	}
+	return defaultValue
+}
+
+func getFloatEnv(envVar string, defaultValue float64) float64 {
+	if val, ok := os.LookupEnv(envVar); ok {
+		val, err := strconv.ParseFloat(val, 64)
+		if err != nil {
+			logger.Error(err, "unable to parse environment variable", "env", envVar)
+			os.Exit(1)
+		}
+		return val
+	}
+	return defaultValue
+}
+
+func getDurationEnv(envVar string, defaultValue time.Duration) time.Duration {
+	if val, ok := os.LookupEnv(envVar); ok {
+		val, err := time.ParseDuration(val)
+		if err != nil {
+			logger.Error(err, "unable to parse environment variable", "env", envVar)
+			os.Exit(1)
+		}
+		return val
+	}
+	return defaultValue
+}
+
+func newServeMux() *runtime.ServeMux {
+	marshaler := &CustomJSONPb{}
+	marshaler.EmitUnpopulated = false
+	marshaler.DiscardUnknown = false
+
+	return runtime.NewServeMux(
+		runtime.WithMarshalerOption(runtime.MIMEWildcard, marshaler),
+		runtime.WithForwardResponseOption(forwardResponseTrailers),
+		runtime.WithForwardResponseOption(healthResponseStatus),
+		runtime.WithErrorHandler(errorHandler),
+		runtime.WithRoutingErrorHandler(routingErrorHandler),
+		runtime.WithMetadata(clientCertMetadata),
+		runtime.WithIncomingHeaderMatcher(incomingHeaderMatcher),
+		runtime.WithOutgoingHeaderMatcher(outgoingHeaderMatcher),
+	)
+}
+
+// The interceptors of the gRPC client, which record the per-request state used
+// by the handlers of newHandler and adjust the requests and responses.
+func clientInterceptors() grpc.DialOption {
+	return grpc.WithChainUnaryInterceptor(requestedOutputsInterceptor, metricsInterceptor, accessLogInterceptor,
+		payloadLoggerInterceptor, tracingInterceptor)
+}
+
+// Wraps the gateway in the handlers of the proxy. The access and payload loggers
+// are nil when disabled.
+func newHandler(mux *runtime.ServeMux, tracker *requestTracker, probe *backendProbe, metrics *proxyMetrics,
+	accessLog *accessLogger, payloadLog *payloadLogger) http.Handler {
+	return tracker.handler(probeHandler(probe, metrics.handler(accessLog.handler(
+		bodyLimitHandler(mux, payloadLog.handler(tracingHandler(binaryDataHandler(mux))))))))
+}
+
 func run() error {
 	logger.Info("Starting REST Proxy...")
 	ctx := context.Background()
 	ctx, cancel := context.WithCancel(ctx)
 	defer cancel()
 
-	marshaler := &CustomJSONPb{}
-	marshaler.EmitUnpopulated = false
-	marshaler.DiscardUnknown = false
+	shutdownTracing, err := setupTracing(ctx)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if err := shutdownTracing(ctx); err != nil {
+			logger.Error(err, "Failed to flush traces")
+		}
+	}()
+
+	getHeaderRulesEnv(&requestHeaderRules, requestHeadersEnvVar, requestHeaderPrefixesEnvVar)
+	getHeaderRulesEnv(&responseHeaderRules, responseHeadersEnvVar, responseHeaderPrefixesEnvVar)
 
 	// Register gRPC server endpoint
-	mux := runtime.NewServeMux(
-		runtime.WithMarshalerOption(runtime.MIMEWildcard, marshaler),
-	)
+	mux := newServeMux()
 
 	maxGrpcMessageSizeBytes = getIntegerEnv(restProxyGrpcMaxMsgSize, maxGrpcMessageSizeBytes)
+	getLimitsEnv()
+	if err := getIntOverflowEnv(); err != nil {
+		return err
+	}
 
+	certs := &certWatcher{}
 	var opts []grpc.DialOption
 	var transportCreds credentials.TransportCredentials
 	if useTLS, ok := os.LookupEnv(restProxyTlsEnvVar); ok && useTLS == "true" {
 		logger.Info("Using TLS")
 
-		skipVerifyBool := false
-		skipVerify, ok := os.LookupEnv(restProxySkipVerifyEnvVar)
-		if ok {
-			var err error
-			skipVerifyBool, err = strconv.ParseBool(skipVerify)
-			if err != nil {
-				logger.Error(err, "Failed to parse %s=%s to bool", restProxySkipVerifyEnvVar, skipVerify)
-				skipVerifyBool = false
-			}
+		if transportCreds, err = grpcClientCredentials(certs); err != nil {
+			return err
 		}
-
-		transportCreds = credentials.NewTLS(&tls.Config{
-			InsecureSkipVerify: skipVerifyBool,
-		})
 	} else {
 		logger.Info("Not using TLS")
 		transportCreds = insecure.NewCredentials()
 	}
 	opts = []grpc.DialOption{
 		grpc.WithTransportCredentials(transportCreds),
-		grpc.WithBlock(),
 		grpc.WithDefaultCallOptions(grpc.MaxCallRecvMsgSize(maxGrpcMessageSizeBytes)),
+		clientInterceptors(),
 	}
-	inferenceServicePort = getIntegerEnv(restProxyGrpcPortEnvVar, inferenceServicePort)
+	grpcTarget := getGrpcTarget()
 
-	logger.Info("Registering gRPC Inference Service Handler", "Host", grpcServerEndpoint, "Port", inferenceServicePort, "MaxCallRecvMsgSize", maxGrpcMessageSizeBytes)
-	err := gw.RegisterGRPCInferenceServiceHandlerFromEndpoint(
-		ctx, mux, fmt.Sprintf("%s:%d", grpcServerEndpoint, inferenceServicePort), opts)
+	logger.Info("Registering gRPC Inference Service Handler", "Target", grpcTarget, "MaxCallRecvMsgSize", maxGrpcMessageSizeBytes)
+	// the connection is established in the background so that the proxy can
+	// report the state of the inference server while it is unavailable
+	conn, err := grpc.DialContext(ctx, grpcTarget, opts...)
 	if err != nil {
 		return err
 	}
+	defer func() {
+		// after the server is shut down
+		if cerr := conn.Close(); cerr != nil {
+			logger.Error(cerr, "Failed to close gRPC connection")
+		}
+	}()
+	conn.Connect()
+	go logConnectivityState(ctx, conn)
+	if err = gw.RegisterGRPCInferenceServiceHandler(ctx, mux, conn); err != nil {
+		return err
+	}
+	probe := newBackendProbe(conn, getBoolEnv(readyzServerReadyEnvVar, false))
 
 	listenPort = getIntegerEnv(restProxyPortEnvVar, listenPort)
 
 	// Start HTTP(S) server (and proxy calls to gRPC server endpoint)
+	var accessLog *accessLogger
+	if getBoolEnv(accessLogEnvVar, true) {
+		if accessLog, err = newAccessLogger(logger.WithName("access"),
+			getFloatEnv(accessLogSampleRateEnvVar, accessLogSampleRate)); err != nil {
+			return err
+		}
+	}
+	payloadLog, err := getPayloadLoggerEnv()
+	if err != nil {
+		return err
+	}
+	payloadLogDone := make(chan struct{})
+	if payloadLog != nil {
+		logger.Info("Logging inference payloads", "url", payloadLog.url)
+		go func() {
+			defer close(payloadLogDone)
+			payloadLog.run(ctx)
+		}()
+	} else {
+		close(payloadLogDone)
+	}
+	tracker := &requestTracker{}
+	metrics := newProxyMetrics()
+	handler := newHandler(mux, tracker, probe, metrics, accessLog, payloadLog)
+	server := &http.Server{Addr: fmt.Sprintf(":%d", listenPort), Handler: handler}
 
 	if certPath, ok := os.LookupEnv(tlsCertEnvVar); ok {
 		keyPath := os.Getenv(tlsKeyEnvVar)
-		logger.Info(fmt.Sprintf("Listening on port %d with TLS", listenPort))
-		return http.ListenAndServeTLS(fmt.Sprintf(":%d", listenPort), certPath, keyPath, mux)
+		if server.TLSConfig, err = serverTLSConfig(certs, certPath, keyPath); err != nil {
+			return err
+		}
+	}
+	go certs.watch(ctx, getDurationEnv(tlsReloadIntervalEnvVar, tlsReloadInterval))
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGTERM, os.Interrupt)
+	serveErr := make(chan error, 1)
+	go func() {
+		if server.TLSConfig != nil {
+			logger.Info(fmt.Sprintf("Listening on port %d with TLS", listenPort), "ClientAuth", server.TLSConfig.ClientAuth.String())
+			serveErr <- server.ListenAndServeTLS("", "")
+		} else {
+			logger.Info(fmt.Sprintf("Listening on port %d", listenPort))
+			serveErr <- server.ListenAndServe()
+		}
+	}()
+
+	select {
+	case err = <-serveErr:
+		return err
+	case sig := <-signals:
+		logger.Info("Received signal, shutting down", "signal", sig.String())
 	}
-	logger.Info(fmt.Sprintf("Listening on port %d", listenPort))
-	return http.ListenAndServe(fmt.Sprintf(":%d", listenPort), mux)
+	drained, cutOff, err := shutdownServer(server, tracker, probe,
+		getDurationEnv(shutdownDelayEnvVar, shutdownDelay), getDurationEnv(shutdownTimeoutEnvVar, shutdownTimeout))
+	logger.Info("Server shut down", "drained", drained, "cutOff", cutOff)
+	// no more payload events are queued, send those still in the queue
+	cancel()
+	<-payloadLogDone
+	return err
 }
 
 func main() {
@@ -0,0 +1,52 @@
+/*
+Copyright 2021 IBM Corporation
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"os"
+	"testing"
+)
+
+func TestGetGrpcTarget(t *testing.T) {
+	tests := []struct {
+		target   string
+		port     string
+		expected string
+	}{
+		{"model-server:9000", "8085", "model-server:9000"},
+		{"", "8085", "localhost:8085"},
+		{"", "", "localhost:8033"},
+		{"unix:///var/run/model.sock", "", "unix:///var/run/model.sock"},
+		{"dns:///model-server:9000", "8085", "dns:///model-server:9000"},
+	}
+	for _, test := range tests {
+		t.Setenv(restProxyGrpcTargetEnvVar, test.target)
+		if test.port == "" {
+			t.Setenv(restProxyGrpcPortEnvVar, "")
+			os.Unsetenv(restProxyGrpcPortEnvVar)
+		} else {
+			t.Setenv(restProxyGrpcPortEnvVar, test.port)
+		}
+		if target := getGrpcTarget(); target != test.expected {
+			t.Errorf("expected target %q for %s=%q %s=%q, got %q", test.expected,
+				restProxyGrpcTargetEnvVar, test.target, restProxyGrpcPortEnvVar, test.port, target)
+		}
+	}
+	if inferenceServicePort != 8033 {
+		t.Errorf("expected the default port to be unchanged, got %d", inferenceServicePort)
+	}
+}
@@ -21,6 +21,7 @@ import (
 	"encoding/binary"
 	"fmt"
 	"reflect"
+	"strings"
 
 	"github.com/grpc-ecosystem/grpc-gateway/v2/runtime"
 	gw "github.com/kserve/rest-proxy/gen"
@@ -37,6 +38,7 @@ const (
 	INT32  = "INT32"
 	INT64  = "INT64"
 	FP16   = "FP16"
+	BF16   = "BF16"
 	FP32   = "FP32"
 	FP64   = "FP64"
 	BYTES  = "BYTES"
@@ -44,6 +46,7 @@ const (
 
 const CONTENT_TYPE = "content_type"
 const BASE64 = "base64"
+const UTF8 = "utf8"
 
 type CustomJSONPb struct {
 	runtime.JSONPb
@@ -69,18 +72,30 @@ var tensorTypes = map[string]tensorType{
 	INT16:  {2, sliceType(int16(0))},
 	INT32:  {4, sliceType(int32(0))},
 	INT64:  {8, sliceType(int64(0))},
-	FP16:   {2, nil}, //TODO
+	FP16:   {2, sliceType(uint16(0))}, // converted to float32 after reading
+	BF16:   {2, sliceType(uint16(0))}, // converted to float32 after reading
 	FP32:   {4, sliceType(float32(0))},
 	FP64:   {8, sliceType(float64(0))},
 	BYTES:  {1, sliceType(byte(0))},
 }
 
+var supportedDatatypes = strings.Join([]string{
+	BOOL, UINT8, UINT16, UINT32, UINT64, INT8, INT16, INT32, INT64, FP16, BF16, FP32, FP64, BYTES,
+}, ", ")
+
+func unsupportedDatatypeError(dataType, tensorName string) error {
+	return fmt.Errorf("unsupported datatype %s for tensor %s, supported datatypes are: %s",
+		dataType, tensorName, supportedDatatypes)
+}
+
 type RESTResponse struct {
 	ModelName    string                 `json:"model_name,omitempty"`
 	ModelVersion string                 `json:"model_version,omitempty"`
 	Id           string                 `json:"id,omitempty"`
 	Parameters   map[string]interface{} `json:"parameters,omitempty"`
 	Outputs      []OutputTensor         `json:"outputs,omitempty"`
+
+	binaryData [][]byte // appended to the JSON response as binary tensor data
 }
 
 type OutputTensor struct {
@@ -94,11 +109,26 @@ type OutputTensor struct {
 // This function adjusts the gRPC response before marshaling and
 // returning to the user.
 func (c *CustomJSONPb) Marshal(v interface{}) ([]byte, error) {
-	if r, ok := v.(*gw.ModelInferResponse); ok {
-		var err error
-		if v, err = transformResponse(r); err != nil {
+	switch r := v.(type) {
+	case *gw.ModelInferResponse:
+		resp, err := transformResponse(r)
+		if err != nil {
 			return nil, err
 		}
+		if len(resp.binaryData) != 0 {
+			return c.marshalWithBinaryData(resp)
+		}
+		v = resp
+	case *gw.ServerLiveResponse:
+		v = &LiveResponse{Live: r.Live}
+	case *gw.ServerReadyResponse:
+		v = &ReadyResponse{Ready: r.Ready}
+	case *gw.ModelReadyResponse:
+		v = &ReadyResponse{Ready: r.Ready}
+	case *gw.ServerMetadataResponse:
+		v = transformServerMetadata(r)
+	case *gw.ModelMetadataResponse:
+		v = transformModelMetadata(r)
 	}
 	return c.JSONPb.Marshal(v)
 }
@@ -118,23 +148,27 @@ func transformResponse(r *gw.ModelInferResponse) (*RESTResponse, error) {
 		tensor.Datatype = output.Datatype
 		tensor.Shape = output.Shape
 		tensor.Parameters = parameterMapToJson(output.Parameters)
-		if tensor.Datatype == FP16 {
-			return nil, fmt.Errorf("FP16 tensors not supported (request tensor %s)", tensor.Name) //TODO
-		}
-		if tensor.Datatype == BYTES {
-			tensor.Parameters[CONTENT_TYPE] = BASE64
+		if size, ok := outputBinaryDataSize(output); ok {
+			// the raw bytes are returned as-is after the JSON response
+			if index >= len(r.RawOutputContents) || int64(len(r.RawOutputContents[index])) != size {
+				return nil, fmt.Errorf("missing binary data for output tensor %s", tensor.Name)
+			}
+			resp.binaryData = append(resp.binaryData, r.RawOutputContents[index])
+			continue
 		}
 		if r.RawOutputContents != nil {
 			tt, ok := tensorTypes[tensor.Datatype]
 			if !ok {
-				return nil, fmt.Errorf("unsupported datatype in inference response outputs: %s",
-					tensor.Datatype)
+				return nil, unsupportedDatatypeError(tensor.Datatype, tensor.Name)
 			}
 			numElements := int(elementCount(tensor.Shape))
 			var err error
-			if tensor.Datatype == BYTES {
+			switch tensor.Datatype {
+			case BYTES:
 				tensor.Data, err = splitRawBytes(r.RawOutputContents[index], numElements)
-			} else {
+			case FP16, BF16:
+				tensor.Data, err = decode16BitFloats(tensor.Datatype, tensor.Name, r.RawOutputContents[index], numElements)
+			default:
 				tensor.Data, err = readBytes(r.RawOutputContents[index], tt, 0, numElements)
 			}
 			if err != nil {
@@ -156,19 +190,50 @@ func transformResponse(r *gw.ModelInferResponse) (*RESTResponse, error) {
 				tensor.Data = output.Contents.Fp32Contents
 			case FP64:
 				tensor.Data = output.Contents.Fp64Contents
+			case FP16, BF16:
+				return nil, fmt.Errorf("%s output tensor %s must be returned in raw_output_contents",
+					tensor.Datatype, tensor.Name)
 			case BYTES:
-				// this will be encoded as array of b64-encoded strings
-				//TODO support UTF8 if it's specified as the content type
 				tensor.Data = output.Contents.BytesContents
 			default:
-				return nil, fmt.Errorf("unsupported datatype in inference response outputs: %s",
-					tensor.Datatype)
+				return nil, unsupportedDatatypeError(tensor.Datatype, tensor.Name)
 			}
 		}
+		if tensor.Datatype == BYTES {
+			setBytesData(tensor, isUTF8Content(output.Parameters))
+		}
 	}
 	return resp, nil
 }
 
+// BYTES tensor data is returned as an array of b64-encoded strings unless utf8
+// was requested, in which case it falls back to base64 if any element is not
+// valid utf8. The content_type parameter is set to the encoding used.
+func setBytesData(tensor *OutputTensor, utf8Requested bool) {
+	elements, _ := tensor.Data.([][]byte)
+	if utf8Requested {
+		if strs, ok := utf8Strings(elements); ok {
+			tensor.Data = strs
+			tensor.Parameters[CONTENT_TYPE] = UTF8
+			return
+		}
+		logger.Info("BYTES output tensor is not valid utf8, returning it base64-encoded", "tensor", tensor.Name)
+	}
+	tensor.Parameters[CONTENT_TYPE] = BASE64
+}
+
+func (c *CustomJSONPb) marshalWithBinaryData(resp *RESTResponse) ([]byte, error) {
+	header, err := c.JSONPb.Marshal(resp)
+	if err != nil {
+		return nil, err
+	}
+	buf := bytes.NewBuffer(header)
+	for _, data := range resp.binaryData {
+		buf.Write(data)
+	}
+	return buf.Bytes(), nil
+}
+
 func elementCount(shape []int64) int64 {
 	var count int64 = 1
 	for j := range shape {
@@ -174,3 +174,241 @@ func TestRESTResponseRawOutput(t *testing.T) {
 		t.Errorf("diff :%s", d)
 	}
 }
+
+func TestFP16RESTResponseRawOutput(t *testing.T) {
+	c := CustomJSONPb{}
+	v := &gw.ModelInferResponse{
+		ModelName: "example",
+		Id:        "foo",
+		Outputs: []*gw.ModelInferResponse_InferOutputTensor{{
+			Name:     "predict",
+			Datatype: "FP16",
+			Shape:    []int64{2, 2},
+		}},
+		RawOutputContents: [][]byte{
+			{0x00, 0x3c, 0x66, 0x2e, 0x00, 0xc0, 0x01, 0x00},
+		},
+	}
+
+	output, err := c.Marshal(v)
+	if err != nil {
+		t.Error(err)
+	}
+
+	expected := `{"model_name":"example","id":"foo","outputs":[{"name":"predict","datatype":"FP16","shape":[2,2],"data":[1,0.099975586,-2,5.9604645e-8]}]}`
+	if d := cmp.Diff(expected, string(output)); d != "" {
+		t.Errorf("diff :%s", d)
+	}
+}
+
+func TestBF16RESTResponseRawOutput(t *testing.T) {
+	c := CustomJSONPb{}
+	v := &gw.ModelInferResponse{
+		ModelName: "example",
+		Outputs: []*gw.ModelInferResponse_InferOutputTensor{{
+			Name:     "predict",
+			Datatype: "BF16",
+			Shape:    []int64{3},
+		}},
+		RawOutputContents: [][]byte{
+			{0x80, 0x3f, 0xcd, 0x3d, 0x00, 0xc0},
+		},
+	}
+
+	output, err := c.Marshal(v)
+	if err != nil {
+		t.Error(err)
+	}
+
+	expected := `{"model_name":"example","outputs":[{"name":"predict","datatype":"BF16","shape":[3],"data":[1,0.100097656,-2]}]}`
+	if d := cmp.Diff(expected, string(output)); d != "" {
+		t.Errorf("diff :%s", d)
+	}
+}
+
+func TestFloat16NonFiniteRESTResponse(t *testing.T) {
+	tests := []struct {
+		datatype string
+		raw      []byte
+		expected string
+	}{
+		{FP16, []byte{0x00, 0x7c, 0x00, 0xfc, 0x00, 0x7e, 0x00, 0x3c}, `["Infinity","-Infinity","NaN",1]`},
+		{BF16, []byte{0x80, 0x7f, 0x80, 0xff, 0xc0, 0x7f, 0x80, 0x3f}, `["Infinity","-Infinity","NaN",1]`},
+	}
+	for _, test := range tests {
+		c := CustomJSONPb{}
+		v := &gw.ModelInferResponse{
+			ModelName: "example",
+			Outputs: []*gw.ModelInferResponse_InferOutputTensor{{
+				Name:     "predict",
+				Datatype: test.datatype,
+				Shape:    []int64{4},
+			}},
+			RawOutputContents: [][]byte{test.raw},
+		}
+
+		output, err := c.Marshal(v)
+		if err != nil {
+			t.Error(err)
+		}
+
+		expected := `{"model_name":"example","outputs":[{"name":"predict","datatype":"` + test.datatype +
+			`","shape":[4],"data":` + test.expected + `}]}`
+		if d := cmp.Diff(expected, string(output)); d != "" {
+			t.Errorf("diff :%s", d)
+		}
+	}
+}
+
+func TestFloat16TruncatedRESTResponse(t *testing.T) {
+	for _, datatype := range []string{FP16, BF16} {
+		c := CustomJSONPb{}
+		v := &gw.ModelInferResponse{
+			ModelName: "example",
+			Outputs: []*gw.ModelInferResponse_InferOutputTensor{{
+				Name:     "predict",
+				Datatype: datatype,
+				Shape:    []int64{4},
+			}},
+			RawOutputContents: [][]byte{{0x00, 0x3c}},
+		}
+
+		_, err := c.Marshal(v)
+		expected := "raw contents of " + datatype + " output tensor predict has 2 bytes, expected 8"
+		if err == nil || err.Error() != expected {
+			t.Errorf("expected error %q, got %v", expected, err)
+		}
+	}
+}
+
+func TestUTF8BytesRESTResponse(t *testing.T) {
+	c := CustomJSONPb{}
+	utf8Param := map[string]*gw.InferParameter{
+		"content_type": {ParameterChoice: &gw.InferParameter_StringParam{StringParam: "str"}},
+	}
+	v := &gw.ModelInferResponse{
+		ModelName: "example",
+		Outputs: []*gw.ModelInferResponse_InferOutputTensor{{
+			Name:       "text",
+			Datatype:   "BYTES",
+			Shape:      []int64{2},
+			Parameters: utf8Param,
+			Contents:   &gw.InferTensorContents{BytesContents: [][]byte{[]byte("héllo"), []byte("wörld")}},
+		}, {
+			Name:       "invalid",
+			Datatype:   "BYTES",
+			Shape:      []int64{1},
+			Parameters: utf8Param,
+			Contents:   &gw.InferTensorContents{BytesContents: [][]byte{{0xff, 0xfe}}},
+		}},
+	}
+	output, err := c.Marshal(v)
+	if err != nil {
+		t.Error(err)
+	}
+	expected := `{"model_name":"example","outputs":[` +
+		`{"name":"text","datatype":"BYTES","shape":[2],"parameters":{"content_type":"utf8"},"data":["héllo","wörld"]},` +
+		`{"name":"invalid","datatype":"BYTES","shape":[1],"parameters":{"content_type":"base64"},"data":["//4="]}]}`
+	if d := cmp.Diff(expected, string(output)); d != "" {
+		t.Errorf("diff :%s", d)
+	}
+
+	// raw output contents
+	v = generateProtoBufBytesResponseRawOutput()
+	v.Outputs[0].Parameters = utf8Param
+	output, err = c.Marshal(v)
+	if err != nil {
+		t.Error(err)
+	}
+	expected = `{"model_name":"example","id":"foo","parameters":{"bool_param":false,"content_type":"bar","headers":null,"int_param":12345},` +
+		`"outputs":[{"name":"predict","datatype":"BYTES","shape":[2,2],"parameters":{"content_type":"utf8"},"data":["String1","String2","String3","String4"]}]}`
+	if d := cmp.Diff(expected, string(output)); d != "" {
+		t.Errorf("diff :%s", d)
+	}
+}
+
+func TestHealthRESTResponse(t *testing.T) {
+	c := CustomJSONPb{}
+	tests := []struct {
+		resp     interface{}
+		expected string
+	}{
+		{&gw.ServerLiveResponse{Live: true}, `{"live":true}`},
+		{&gw.ServerLiveResponse{}, `{"live":false}`},
+		{&gw.ServerReadyResponse{Ready: true}, `{"ready":true}`},
+		{&gw.ServerReadyResponse{}, `{"ready":false}`},
+		{&gw.ModelReadyResponse{Ready: true}, `{"ready":true}`},
+		{&gw.ModelReadyResponse{}, `{"ready":false}`},
+	}
+	for _, test := range tests {
+		output, err := c.Marshal(test.resp)
+		if err != nil {
+			t.Error(err)
+		}
+		if d := cmp.Diff(test.expected, string(output)); d != "" {
+			t.Errorf("diff :%s", d)
+		}
+	}
+}
+
+func TestServerMetadataRESTResponse(t *testing.T) {
+	c := CustomJSONPb{}
+	defer func(e []string) { proxyExtensions = e }(proxyExtensions)
+	proxyExtensions = []string{"binary_tensor_data"}
+
+	v := &gw.ServerMetadataResponse{Name: "triton", Version: "2.0", Extensions: []string{"model_repository", "binary_tensor_data"}}
+	output, err := c.Marshal(v)
+	if err != nil {
+		t.Error(err)
+	}
+	expected := `{"name":"triton","version":"2.0","extensions":["model_repository","binary_tensor_data"]}`
+	if d := cmp.Diff(expected, string(output)); d != "" {
+		t.Errorf("diff :%s", d)
+	}
+
+	output, err = c.Marshal(&gw.ServerMetadataResponse{Name: "mlserver"})
+	if err != nil {
+		t.Error(err)
+	}
+	expected = `{"name":"mlserver","version":"","extensions":["binary_tensor_data"]}`
+	if d := cmp.Diff(expected, string(output)); d != "" {
+		t.Errorf("diff :%s", d)
+	}
+}
+
+func TestModelMetadataRESTResponse(t *testing.T) {
+	c := CustomJSONPb{}
+	v := &gw.ModelMetadataResponse{
+		Name:     "example",
+		Versions: []string{"1", "2"},
+		Platform: "onnx_onnxv1",
+		Inputs: []*gw.ModelMetadataResponse_TensorMetadata{{
+			Name:     "input",
+			Datatype: "FP32",
+			Shape:    []int64{-1, 784},
+		}},
+		Outputs: []*gw.ModelMetadataResponse_TensorMetadata{{
+			Name:     "scalar",
+			Datatype: "INT64",
+		}},
+	}
+	output, err := c.Marshal(v)
+	if err != nil {
+		t.Error(err)
+	}
+	expected := `{"name":"example","versions":["1","2"],"platform":"onnx_onnxv1",` +
+		`"inputs":[{"name":"input","datatype":"FP32","shape":[-1,784]}],` +
+		`"outputs":[{"name":"scalar","datatype":"INT64","shape":[]}]}`
+	if d := cmp.Diff(expected, string(output)); d != "" {
+		t.Errorf("diff :%s", d)
+	}
+
+	output, err = c.Marshal(&gw.ModelMetadataResponse{Name: "example", Platform: "sklearn"})
+	if err != nil {
+		t.Error(err)
+	}
+	expected = `{"name":"example","platform":"sklearn","inputs":[],"outputs":[]}`
+	if d := cmp.Diff(expected, string(output)); d != "" {
+		t.Errorf("diff :%s", d)
+	}
+}
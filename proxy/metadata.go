@@ -0,0 +1,92 @@
+/*
+Copyright 2021 IBM Corporation
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	gw "github.com/kserve/rest-proxy/gen"
+)
+
+// Protocol extensions implemented by the REST proxy itself, these are
+// advertised in addition to any extensions reported by the gRPC server.
+var proxyExtensions = []string{BINARY_TENSOR_DATA}
+
+type ServerMetadataResponse struct {
+	Name       string   `json:"name"`
+	Version    string   `json:"version"`
+	Extensions []string `json:"extensions"`
+}
+
+func transformServerMetadata(r *gw.ServerMetadataResponse) *ServerMetadataResponse {
+	return &ServerMetadataResponse{
+		Name:       r.Name,
+		Version:    r.Version,
+		Extensions: mergeExtensions(r.Extensions, proxyExtensions),
+	}
+}
+
+// Returns the union of both lists, preserving order and dropping duplicates.
+func mergeExtensions(server, proxy []string) []string {
+	merged := make([]string, 0, len(server)+len(proxy))
+	seen := make(map[string]bool, len(server)+len(proxy))
+	for _, list := range [][]string{server, proxy} {
+		for _, ext := range list {
+			if !seen[ext] {
+				seen[ext] = true
+				merged = append(merged, ext)
+			}
+		}
+	}
+	return merged
+}
+
+type ModelMetadataResponse struct {
+	Name     string           `json:"name"`
+	Versions []string         `json:"versions,omitempty"`
+	Platform string           `json:"platform"`
+	Inputs   []TensorMetadata `json:"inputs"`
+	Outputs  []TensorMetadata `json:"outputs"`
+}
+
+type TensorMetadata struct {
+	Name     string  `json:"name"`
+	Datatype string  `json:"datatype"`
+	Shape    []int64 `json:"shape"`
+}
+
+// Default protojson marshaling would render the int64 shapes as strings, so
+// build the metadata response with the field set defined by the REST protocol.
+func transformModelMetadata(r *gw.ModelMetadataResponse) *ModelMetadataResponse {
+	return &ModelMetadataResponse{
+		Name:     r.Name,
+		Versions: r.Versions,
+		Platform: r.Platform,
+		Inputs:   transformTensorMetadata(r.Inputs),
+		Outputs:  transformTensorMetadata(r.Outputs),
+	}
+}
+
+func transformTensorMetadata(tms []*gw.ModelMetadataResponse_TensorMetadata) []TensorMetadata {
+	tensors := make([]TensorMetadata, len(tms))
+	for i, tm := range tms {
+		shape := tm.Shape
+		if shape == nil {
+			shape = []int64{} // scalar tensor
+		}
+		tensors[i] = TensorMetadata{Name: tm.Name, Datatype: tm.Datatype, Shape: shape}
+	}
+	return tensors
+}
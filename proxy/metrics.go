@@ -0,0 +1,245 @@
+/*
+Copyright 2021 IBM Corporation
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/grpc-ecosystem/grpc-gateway/v2/runtime"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	gw "github.com/kserve/rest-proxy/gen"
+)
+
+const METRICS_PATH = "/metrics"
+
+var (
+	requestLabels = []string{"model", "version", "route", "code"}
+	stageLabels   = []string{"model", "version", "route"}
+	sizeBuckets   = prometheus.ExponentialBuckets(256, 4, 10) // 256B to 64MiB
+
+	// The gRPC status codes of requests whose model and version labels are
+	// replaced with a placeholder, since they are unchecked client input.
+	untrustedModelCodes = map[string]bool{
+		codes.NotFound.String():        true,
+		codes.InvalidArgument.String(): true,
+	}
+)
+
+type proxyMetrics struct {
+	registry     *prometheus.Registry
+	requests     *prometheus.CounterVec
+	duration     *prometheus.HistogramVec
+	requestSize  *prometheus.HistogramVec
+	responseSize *prometheus.HistogramVec
+	decode       *prometheus.HistogramVec
+	backend      *prometheus.HistogramVec
+	encode       *prometheus.HistogramVec
+}
+
+func newProxyMetrics() *proxyMetrics {
+	m := &proxyMetrics{
+		registry: prometheus.NewRegistry(),
+		requests: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "rest_proxy_requests_total",
+			Help: "Number of REST requests handled by the proxy.",
+		}, requestLabels),
+		duration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "rest_proxy_request_duration_seconds",
+			Help:    "Total time taken to handle REST requests.",
+			Buckets: prometheus.DefBuckets,
+		}, requestLabels),
+		requestSize: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "rest_proxy_request_size_bytes",
+			Help:    "Size of REST request bodies.",
+			Buckets: sizeBuckets,
+		}, requestLabels),
+		responseSize: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "rest_proxy_response_size_bytes",
+			Help:    "Size of REST response bodies.",
+			Buckets: sizeBuckets,
+		}, requestLabels),
+		decode: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "rest_proxy_decode_duration_seconds",
+			Help:    "Time taken to read and decode REST requests before the gRPC call.",
+			Buckets: prometheus.DefBuckets,
+		}, stageLabels),
+		backend: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "rest_proxy_backend_duration_seconds",
+			Help:    "Time taken by gRPC calls to the inference server.",
+			Buckets: prometheus.DefBuckets,
+		}, requestLabels),
+		encode: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "rest_proxy_encode_duration_seconds",
+			Help:    "Time taken to encode REST responses after the gRPC call.",
+			Buckets: prometheus.DefBuckets,
+		}, stageLabels),
+	}
+	m.registry.MustRegister(m.requests, m.duration, m.requestSize, m.responseSize, m.decode, m.backend, m.encode,
+		collectors.NewGoCollector(), collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}))
+	return m
+}
+
+// Per-request state used to label and time the stages of each request. It is
+// shared with the access log and tracing handlers.
+type requestMetrics struct {
+	model, version, route, code     string
+	start, backendStart, backendEnd time.Time
+	firstWrite                      time.Time
+	status                          int
+	requestSize, responseSize       int64
+}
+
+type requestMetricsKey struct{}
+
+// Returns the requestMetrics of the request, adding them to its context and
+// counting the request and response sizes if they aren't there already.
+func trackRequestMetrics(w http.ResponseWriter, r *http.Request) (*requestMetrics, http.ResponseWriter, *http.Request) {
+	if rm, _ := r.Context().Value(requestMetricsKey{}).(*requestMetrics); rm != nil {
+		return rm, w, r
+	}
+	rm := &requestMetrics{start: time.Now()}
+	r.Body = &countingReader{ReadCloser: r.Body, rm: rm}
+	return rm, &countingResponseWriter{ResponseWriter: w, rm: rm},
+		r.WithContext(context.WithValue(r.Context(), requestMetricsKey{}, rm))
+}
+
+// The HTTP status code of the response, which is 200 if not set explicitly.
+func (rm *requestMetrics) statusCode() int {
+	if rm.status == 0 {
+		return http.StatusOK
+	}
+	return rm.status
+}
+
+// This handler serves the metrics endpoint and records the metrics of all other
+// requests. The request labels are set by metricsInterceptor and errorHandler.
+func (m *proxyMetrics) handler(next http.Handler) http.Handler {
+	metricsHandler := promhttp.HandlerFor(m.registry, promhttp.HandlerOpts{})
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == METRICS_PATH {
+			metricsHandler.ServeHTTP(w, r)
+			return
+		}
+		rm, w, r := trackRequestMetrics(w, r)
+		next.ServeHTTP(w, r)
+		m.observe(rm)
+	})
+}
+
+func (m *proxyMetrics) observe(rm *requestMetrics) {
+	if rm.route == "" {
+		rm.route = "unknown"
+	}
+	if rm.code == "" {
+		rm.code = "Unknown"
+	}
+	model, version := rm.model, rm.version
+	if untrustedModelCodes[rm.code] {
+		// the model may not exist, don't create series for arbitrary client input
+		model, version = "unknown", ""
+	}
+	labels := prometheus.Labels{"model": model, "version": version, "route": rm.route, "code": rm.code}
+	m.requests.With(labels).Inc()
+	m.duration.With(labels).Observe(time.Since(rm.start).Seconds())
+	m.requestSize.With(labels).Observe(float64(rm.requestSize))
+	m.responseSize.With(labels).Observe(float64(rm.responseSize))
+	if rm.backendStart.IsZero() {
+		return // the inference server wasn't called
+	}
+	stage := prometheus.Labels{"model": model, "version": version, "route": rm.route}
+	m.decode.With(stage).Observe(rm.backendStart.Sub(rm.start).Seconds())
+	m.backend.With(labels).Observe(rm.backendEnd.Sub(rm.backendStart).Seconds())
+	if !rm.firstWrite.IsZero() {
+		m.encode.With(stage).Observe(rm.firstWrite.Sub(rm.backendEnd).Seconds())
+	}
+}
+
+// This interceptor records the model, route and gRPC status code of each call,
+// and times the call to the inference server.
+func metricsInterceptor(ctx context.Context, method string, req, reply interface{},
+	cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+	rm, _ := ctx.Value(requestMetricsKey{}).(*requestMetrics)
+	if rm == nil {
+		return invoker(ctx, method, req, reply, cc, opts...)
+	}
+	switch r := req.(type) {
+	case *gw.ModelInferRequest:
+		rm.model, rm.version = r.ModelName, r.ModelVersion
+	case *gw.ModelMetadataRequest:
+		rm.model, rm.version = r.Name, r.Version
+	case *gw.ModelReadyRequest:
+		rm.model, rm.version = r.Name, r.Version
+	}
+	rm.route, _ = runtime.HTTPPathPattern(ctx)
+	rm.backendStart = time.Now()
+	err := invoker(ctx, method, req, reply, cc, opts...)
+	rm.backendEnd = time.Now()
+	rm.code = status.Code(err).String()
+	return err
+}
+
+// Records the gRPC status code of errors, including those raised by the proxy.
+func setErrorMetrics(ctx context.Context, err error) {
+	if rm, _ := ctx.Value(requestMetricsKey{}).(*requestMetrics); rm != nil {
+		rm.code = status.Code(err).String()
+		if rm.route == "" {
+			rm.route, _ = runtime.HTTPPathPattern(ctx)
+		}
+	}
+}
+
+type countingReader struct {
+	io.ReadCloser
+	rm *requestMetrics
+}
+
+func (r *countingReader) Read(p []byte) (int, error) {
+	n, err := r.ReadCloser.Read(p)
+	r.rm.requestSize += int64(n)
+	return n, err
+}
+
+type countingResponseWriter struct {
+	http.ResponseWriter
+	rm *requestMetrics
+}
+
+func (w *countingResponseWriter) WriteHeader(code int) {
+	if w.rm.firstWrite.IsZero() {
+		w.rm.firstWrite = time.Now()
+		w.rm.status = code
+	}
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *countingResponseWriter) Write(p []byte) (int, error) {
+	if w.rm.firstWrite.IsZero() {
+		w.rm.firstWrite = time.Now()
+	}
+	n, err := w.ResponseWriter.Write(p)
+	w.rm.responseSize += int64(n)
+	return n, err
+}
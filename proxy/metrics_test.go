@@ -0,0 +1,127 @@
+/*
+Copyright 2021 IBM Corporation
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+
+	gw "github.com/kserve/rest-proxy/gen"
+)
+
+type testInferServer struct {
+	testInferenceServer
+}
+
+func (s *testInferServer) ModelInfer(_ context.Context, req *gw.ModelInferRequest) (*gw.ModelInferResponse, error) {
+	if req.ModelName != "example" {
+		return nil, status.Errorf(codes.NotFound, "model %s not found", req.ModelName)
+	}
+	return &gw.ModelInferResponse{
+		ModelName: req.ModelName,
+		Outputs: []*gw.ModelInferResponse_InferOutputTensor{{
+			Name: "predict", Datatype: INT64, Shape: []int64{1}, Contents: &gw.InferTensorContents{Int64Contents: []int64{8}},
+		}},
+	}, nil
+}
+
+// Returns the proxy handler of the given inference server, with new metrics if
+// none are given. The access and payload loggers are nil when not tested.
+func newTestProxy(t *testing.T, srv gw.GRPCInferenceServiceServer, metrics *proxyMetrics,
+	accessLog *accessLogger, payloadLog *payloadLogger) http.Handler {
+	t.Helper()
+	conn, err := grpc.Dial(startTestGrpcServer(t, srv), grpc.WithTransportCredentials(insecure.NewCredentials()),
+		clientInterceptors())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	mux := newServeMux()
+	if err = gw.RegisterGRPCInferenceServiceHandler(context.Background(), mux, conn); err != nil {
+		t.Fatal(err)
+	}
+	if metrics == nil {
+		metrics = newProxyMetrics()
+	}
+	return newHandler(mux, &requestTracker{}, newBackendProbe(conn, false), metrics, accessLog, payloadLog)
+}
+
+const inferRequestBody = `{"inputs":[{"name":"input","datatype":"FP32","shape":[1],"data":[1.5]}]}`
+
+func TestMetrics(t *testing.T) {
+	metrics := newProxyMetrics()
+	handler := newTestProxy(t, &testInferServer{}, metrics, nil, nil)
+
+	requests := []struct {
+		path     string
+		body     string
+		expected int
+	}{
+		{"/v2/models/example/infer", inferRequestBody, http.StatusOK},
+		{"/v2/models/example/infer", inferRequestBody, http.StatusOK},
+		{"/v2/models/missing/infer", inferRequestBody, http.StatusNotFound},
+		{"/v2/models/other/infer", inferRequestBody, http.StatusNotFound},
+		{"/v2/models/example/infer", `{"inputs":[{"name":"input","datatype":"FP32","shape":[1],"data":["a"]}]}`, http.StatusBadRequest},
+	}
+	for _, r := range requests {
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, httptest.NewRequest("POST", r.path, strings.NewReader(r.body)))
+		if w.Code != r.expected {
+			t.Errorf("expected status %d for %s, got %d: %s", r.expected, r.path, w.Code, w.Body.String())
+		}
+	}
+
+	route := "/v2/models/{model_name}/infer"
+	for labels, expected := range map[[4]string]float64{
+		{"example", "", route, "OK"}:              2,
+		{"unknown", "", route, "NotFound"}:        2,
+		{"missing", "", route, "NotFound"}:        0,
+		{"unknown", "", route, "InvalidArgument"}: 1,
+		{"example", "", route, "InvalidArgument"}: 0,
+	} {
+		if count := testutil.ToFloat64(metrics.requests.WithLabelValues(labels[:]...)); count != expected {
+			t.Errorf("expected %v requests for labels %v, got %v", expected, labels, count)
+		}
+	}
+	// the stage histograms are only recorded when the inference server was called,
+	// so not for the request which failed to decode
+	for name, expected := range map[string]int{
+		"rest_proxy_request_duration_seconds": 3,
+		"rest_proxy_decode_duration_seconds":  2,
+		"rest_proxy_backend_duration_seconds": 2,
+		"rest_proxy_encode_duration_seconds":  2,
+	} {
+		if count := testutil.CollectAndCount(metrics.registry, name); count != expected {
+			t.Errorf("expected %d %s series, got %d", expected, name, count)
+		}
+	}
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest("GET", "/metrics", nil))
+	if !strings.Contains(w.Body.String(), `rest_proxy_requests_total{code="OK",model="example",route="/v2/models/{model_name}/infer",version=""} 2`) {
+		t.Errorf("unexpected metrics output: %s", w.Body.String())
+	}
+}
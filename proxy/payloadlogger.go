@@ -0,0 +1,326 @@
+/*
+Copyright 2021 IBM Corporation
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"io"
+	mathrand "math/rand"
+	"net/http"
+	"os"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"google.golang.org/grpc"
+
+	gw "github.com/kserve/rest-proxy/gen"
+)
+
+// This file contains the payload logger, which posts inference requests and
+// responses as CloudEvents to an HTTP sink, in the same format as the KServe
+// agent's logger https://kserve.github.io/website/latest/modelserving/logger/logger/
+
+const (
+	payloadLoggerURLEnvVar        = "REST_PROXY_PAYLOAD_LOGGER_URL"
+	payloadLoggerModelsEnvVar     = "REST_PROXY_PAYLOAD_LOGGER_MODELS"
+	payloadLoggerSampleRateEnvVar = "REST_PROXY_PAYLOAD_LOGGER_SAMPLE_RATE"
+	payloadLoggerQueueSizeEnvVar  = "REST_PROXY_PAYLOAD_LOGGER_QUEUE_SIZE"
+	payloadLoggerMaxBodyEnvVar    = "REST_PROXY_PAYLOAD_LOGGER_MAX_BODY_BYTES"
+
+	CE_REQUEST_TYPE  = "org.kubeflow.serving.inference.request"
+	CE_RESPONSE_TYPE = "org.kubeflow.serving.inference.response"
+	CE_SOURCE        = "rest-proxy"
+)
+
+var (
+	payloadLoggerSampleRate = 1.0
+	payloadLoggerQueueSize  = 100
+	payloadLoggerMaxBody    = 1 << 20 // 1MiB
+	payloadLoggerTimeout    = 5 * time.Second
+	// how long the events still queued at shutdown are sent for
+	payloadLoggerDrainTimeout = 5 * time.Second
+)
+
+type payloadEvent struct {
+	id, eventType, model, contentType string
+	time                              time.Time
+	body                              []byte
+	truncated                         bool
+}
+
+// Logs the payloads of inference requests for the given models, or of all
+// models if none are given, sampled at the given rate between 0 and 1. Events
+// are sent asynchronously and dropped when the queue is full, so that the sink
+// never blocks inference. Bodies are truncated to maxBody bytes to bound the
+// memory held by the queue. A nil payloadLogger disables payload logging.
+type payloadLogger struct {
+	url        string
+	models     map[string]bool
+	sampleRate float64
+	maxBody    int
+	client     *http.Client
+	queue      chan *payloadEvent
+	dropped    atomic.Int64
+}
+
+func newPayloadLogger(url string, models []string, sampleRate float64, queueSize, maxBody int) (*payloadLogger, error) {
+	if sampleRate < 0 || sampleRate > 1 {
+		return nil, fmt.Errorf("payload logger sample rate must be between 0 and 1, got %v", sampleRate)
+	}
+	if queueSize < 1 {
+		return nil, fmt.Errorf("payload logger queue size must be positive, got %d", queueSize)
+	}
+	if maxBody < 0 {
+		return nil, fmt.Errorf("payload logger max body bytes must not be negative, got %d", maxBody)
+	}
+	l := &payloadLogger{
+		url:        url,
+		sampleRate: sampleRate,
+		maxBody:    maxBody,
+		client:     &http.Client{Timeout: payloadLoggerTimeout},
+		queue:      make(chan *payloadEvent, queueSize),
+	}
+	if len(models) > 0 {
+		l.models = map[string]bool{}
+		for _, model := range models {
+			l.models[model] = true
+		}
+	}
+	return l, nil
+}
+
+// Returns the payload logger configured by the environment, or nil if no sink
+// URL is set.
+func getPayloadLoggerEnv() (*payloadLogger, error) {
+	url := os.Getenv(payloadLoggerURLEnvVar)
+	if url == "" {
+		return nil, nil
+	}
+	var models []string
+	for _, model := range strings.Split(os.Getenv(payloadLoggerModelsEnvVar), ",") {
+		if model = strings.TrimSpace(model); model != "" {
+			models = append(models, model)
+		}
+	}
+	return newPayloadLogger(url, models, getFloatEnv(payloadLoggerSampleRateEnvVar, payloadLoggerSampleRate),
+		getIntegerEnv(payloadLoggerQueueSizeEnvVar, payloadLoggerQueueSize),
+		getIntegerEnv(payloadLoggerMaxBodyEnvVar, payloadLoggerMaxBody))
+}
+
+// Per-request state used to set the id of the events, which is the id of the
+// inference request, or else of the response.
+type payloadLogEntry struct {
+	id string
+}
+
+type payloadLogEntryKey struct{}
+
+// Returns the model name of inference request paths, which are of the form
+// /v2/models/{model_name}[/versions/{model_version}]/infer
+func inferenceModelName(path string) (string, bool) {
+	parts := strings.Split(strings.Trim(path, "/"), "/")
+	if (len(parts) != 4 && (len(parts) != 6 || parts[3] != "versions")) ||
+		parts[0] != "v2" || parts[1] != "models" || parts[len(parts)-1] != "infer" {
+		return "", false
+	}
+	return parts[2], true
+}
+
+func (l *payloadLogger) sampled(r *http.Request) (string, bool) {
+	if r.Method != http.MethodPost {
+		return "", false
+	}
+	model, ok := inferenceModelName(r.URL.Path)
+	if !ok || (l.models != nil && !l.models[model]) {
+		return "", false
+	}
+	return model, mathrand.Float64() < l.sampleRate
+}
+
+// This handler captures the request and response bodies of sampled inference
+// requests and queues them to be sent to the sink.
+func (l *payloadLogger) handler(next http.Handler) http.Handler {
+	if l == nil {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		model, ok := l.sampled(r)
+		if !ok {
+			next.ServeHTTP(w, r)
+			return
+		}
+		requestBody := &truncatingBuffer{max: l.maxBody}
+		r.Body = struct {
+			io.Reader
+			io.Closer
+		}{io.TeeReader(r.Body, requestBody), r.Body}
+		cw := &captureResponseWriter{ResponseWriter: w, body: truncatingBuffer{max: l.maxBody}}
+		entry := &payloadLogEntry{}
+		received := time.Now()
+		next.ServeHTTP(cw, r.WithContext(context.WithValue(r.Context(), payloadLogEntryKey{}, entry)))
+		// read any part of the body that wasn't decoded, so that the whole request is logged
+		_, _ = io.Copy(io.Discard, r.Body)
+
+		if entry.id == "" {
+			entry.id = randomID()
+		}
+		l.enqueue(&payloadEvent{id: entry.id, eventType: CE_REQUEST_TYPE, model: model, time: received,
+			contentType: r.Header.Get("Content-Type"), body: requestBody.Bytes(), truncated: requestBody.truncated})
+		l.enqueue(&payloadEvent{id: entry.id, eventType: CE_RESPONSE_TYPE, model: model, time: time.Now(),
+			contentType: cw.Header().Get("Content-Type"), body: cw.body.Bytes(), truncated: cw.body.truncated})
+	})
+}
+
+func (l *payloadLogger) enqueue(event *payloadEvent) {
+	select {
+	case l.queue <- event:
+	default:
+		l.dropped.Add(1)
+	}
+}
+
+// Sends the queued events until the context is cancelled, which should happen
+// once the server is shut down, then sends the events still queued for up to
+// payloadLoggerDrainTimeout. Sends in progress aren't aborted by the cancellation.
+func (l *payloadLogger) run(ctx context.Context) {
+	sendCtx := context.WithoutCancel(ctx)
+	for {
+		select {
+		case <-ctx.Done():
+			l.drain(sendCtx)
+			return
+		case event := <-l.queue:
+			l.sendEvent(sendCtx, event)
+		}
+	}
+}
+
+func (l *payloadLogger) drain(ctx context.Context) {
+	ctx, cancel := context.WithTimeout(ctx, payloadLoggerDrainTimeout)
+	defer cancel()
+	for {
+		select {
+		case event := <-l.queue:
+			if ctx.Err() != nil {
+				dropped := int64(len(l.queue)) + 1
+				logger.Info("Timed out sending the queued payload events, dropped events", "dropped", dropped)
+				return
+			}
+			l.sendEvent(ctx, event)
+		default:
+			return
+		}
+	}
+}
+
+func (l *payloadLogger) sendEvent(ctx context.Context, event *payloadEvent) {
+	if err := l.send(ctx, event); err != nil {
+		logger.Error(err, "Failed to send payload event", "id", event.id, "type", event.eventType)
+	}
+	if dropped := l.dropped.Swap(0); dropped > 0 {
+		logger.Info("Payload logger queue is full, dropped events", "dropped", dropped)
+	}
+}
+
+// Sends an event in the binary content mode of the CloudEvents HTTP binding
+// https://github.com/cloudevents/spec/blob/v1.0.2/cloudevents/bindings/http-protocol-binding.md
+func (l *payloadLogger) send(ctx context.Context, event *payloadEvent) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, l.url, bytes.NewReader(event.body))
+	if err != nil {
+		return err
+	}
+	contentType := event.contentType
+	if contentType == "" {
+		contentType = "application/json"
+	}
+	req.Header.Set("Content-Type", contentType)
+	req.Header.Set("Ce-Specversion", "1.0")
+	req.Header.Set("Ce-Id", event.id)
+	req.Header.Set("Ce-Type", event.eventType)
+	req.Header.Set("Ce-Source", CE_SOURCE)
+	req.Header.Set("Ce-Time", event.time.UTC().Format(time.RFC3339Nano))
+	req.Header.Set("Ce-Inferenceservicename", event.model)
+	if event.truncated {
+		// extension attribute marking that the body was cut off at the max body size
+		req.Header.Set("Ce-Truncated", "true")
+	}
+	resp, err := l.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, resp.Body)
+	if resp.StatusCode >= http.StatusMultipleChoices {
+		return fmt.Errorf("payload logger sink returned status %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// This interceptor records the id of inference requests for the payload logger.
+func payloadLoggerInterceptor(ctx context.Context, method string, req, reply interface{},
+	cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+	entry, _ := ctx.Value(payloadLogEntryKey{}).(*payloadLogEntry)
+	if entry == nil {
+		return invoker(ctx, method, req, reply, cc, opts...)
+	}
+	if r, ok := req.(*gw.ModelInferRequest); ok {
+		entry.id = r.Id
+	}
+	err := invoker(ctx, method, req, reply, cc, opts...)
+	if r, ok := reply.(*gw.ModelInferResponse); ok && entry.id == "" && err == nil {
+		entry.id = r.Id
+	}
+	return err
+}
+
+func randomID() string {
+	b := make([]byte, 16)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// Keeps the first max bytes written to it and discards the rest.
+type truncatingBuffer struct {
+	bytes.Buffer
+	max       int
+	truncated bool
+}
+
+func (b *truncatingBuffer) Write(p []byte) (int, error) {
+	n := len(p)
+	if remaining := b.max - b.Len(); n > remaining {
+		p = p[:remaining]
+		b.truncated = true
+	}
+	b.Buffer.Write(p)
+	return n, nil
+}
+
+type captureResponseWriter struct {
+	http.ResponseWriter
+	body truncatingBuffer
+}
+
+func (w *captureResponseWriter) Write(p []byte) (int, error) {
+	w.body.Write(p)
+	return w.ResponseWriter.Write(p)
+}
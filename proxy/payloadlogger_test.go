@@ -0,0 +1,210 @@
+/*
+Copyright 2021 IBM Corporation
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+
+	gw "github.com/kserve/rest-proxy/gen"
+)
+
+type responseIdServer struct {
+	testInferServer
+}
+
+func (s *responseIdServer) ModelInfer(ctx context.Context, req *gw.ModelInferRequest) (*gw.ModelInferResponse, error) {
+	resp, err := s.testInferServer.ModelInfer(ctx, req)
+	if resp != nil && req.Id == "" {
+		resp.Id = "generated-id"
+	}
+	return resp, err
+}
+
+type sinkEvent struct {
+	Id, Type, Source, Model, ContentType, Body string
+}
+
+func startTestSink(t *testing.T) (string, chan sinkEvent) {
+	t.Helper()
+	events := make(chan sinkEvent, 10)
+	sink := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		if r.Header.Get("Ce-Specversion") != "1.0" || r.Header.Get("Ce-Time") == "" {
+			t.Errorf("unexpected CloudEvents headers %v", r.Header)
+		}
+		events <- sinkEvent{Id: r.Header.Get("Ce-Id"), Type: r.Header.Get("Ce-Type"), Source: r.Header.Get("Ce-Source"),
+			Model: r.Header.Get("Ce-Inferenceservicename"), ContentType: r.Header.Get("Content-Type"), Body: string(body)}
+	}))
+	t.Cleanup(sink.Close)
+	return sink.URL, events
+}
+
+func TestPayloadLogger(t *testing.T) {
+	url, events := startTestSink(t)
+	payloadLog, err := newPayloadLogger(url, []string{"example"}, 1, 10, payloadLoggerMaxBody)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go payloadLog.run(ctx)
+	handler := newTestProxy(t, &responseIdServer{}, nil, nil, payloadLog)
+
+	withId := `{"id":"req-1","inputs":[{"name":"input","datatype":"FP32","shape":[1],"data":[1.5]}]}`
+	var responses []string
+	for _, req := range []struct{ path, body string }{
+		{"/v2/models/example/infer", withId},
+		{"/v2/models/missing/infer", withId},                      // not logged
+		{"/v2/models/example/versions/1/infer", inferRequestBody}, // the body isn't decoded on this route
+	} {
+		r := httptest.NewRequest("POST", req.path, strings.NewReader(req.body))
+		r.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, r)
+		if w.Code != http.StatusOK && req.path != "/v2/models/missing/infer" {
+			t.Fatalf("unexpected status %d: %s", w.Code, w.Body.String())
+		}
+		responses = append(responses, w.Body.String())
+	}
+
+	expected := []sinkEvent{
+		{"req-1", CE_REQUEST_TYPE, CE_SOURCE, "example", "application/json", withId},
+		{"req-1", CE_RESPONSE_TYPE, CE_SOURCE, "example", "application/json", responses[0]},
+		{"generated-id", CE_REQUEST_TYPE, CE_SOURCE, "example", "application/json", inferRequestBody},
+		{"generated-id", CE_RESPONSE_TYPE, CE_SOURCE, "example", "application/json", responses[2]},
+	}
+	var received []sinkEvent
+	for range expected {
+		select {
+		case event := <-events:
+			received = append(received, event)
+		case <-time.After(5 * time.Second):
+			t.Fatalf("timed out waiting for events, received %v", received)
+		}
+	}
+	if d := cmp.Diff(expected, received); d != "" {
+		t.Errorf("diff :%s", d)
+	}
+	if !strings.Contains(responses[2], `"id":"generated-id"`) {
+		t.Errorf("expected the response to contain the generated id: %s", responses[2])
+	}
+}
+
+func TestPayloadLoggerDropsWhenFull(t *testing.T) {
+	url, _ := startTestSink(t)
+	payloadLog, err := newPayloadLogger(url, nil, 1, 1, payloadLoggerMaxBody)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the queue isn't consumed, so only the first event fits in it
+	handler := newTestProxy(t, &testInferServer{}, nil, nil, payloadLog)
+	handler.ServeHTTP(httptest.NewRecorder(),
+		httptest.NewRequest("POST", "/v2/models/example/infer", strings.NewReader(inferRequestBody)))
+	if dropped := payloadLog.dropped.Load(); dropped != 1 {
+		t.Errorf("expected 1 dropped event, got %d", dropped)
+	}
+	if event := <-payloadLog.queue; event.eventType != CE_REQUEST_TYPE || event.id == "" {
+		t.Errorf("unexpected queued event %+v", event)
+	}
+}
+
+func TestPayloadLoggerDrainsOnShutdown(t *testing.T) {
+	url, events := startTestSink(t)
+	payloadLog, err := newPayloadLogger(url, nil, 1, 10, payloadLoggerMaxBody)
+	if err != nil {
+		t.Fatal(err)
+	}
+	handler := newTestProxy(t, &testInferServer{}, nil, nil, payloadLog)
+	handler.ServeHTTP(httptest.NewRecorder(),
+		httptest.NewRequest("POST", "/v2/models/example/infer", strings.NewReader(inferRequestBody)))
+
+	// the events queued before the shutdown are still sent
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	payloadLog.run(ctx)
+	if len(events) != 2 || len(payloadLog.queue) != 0 {
+		t.Errorf("expected 2 events to be sent, got %d with %d still queued", len(events), len(payloadLog.queue))
+	}
+}
+
+func TestPayloadLoggerTruncatesBody(t *testing.T) {
+	truncated := make(chan string, 2)
+	sink := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		truncated <- r.Header.Get("Ce-Truncated")
+	}))
+	defer sink.Close()
+	payloadLog, err := newPayloadLogger(sink.URL, nil, 1, 2, 16)
+	if err != nil {
+		t.Fatal(err)
+	}
+	handler := newTestProxy(t, &testInferServer{}, nil, nil, payloadLog)
+	const elements = 100000
+	body := `{"inputs":[{"name":"input","datatype":"FP32","shape":[` + strconv.Itoa(elements) + `],"data":[1.5` +
+		strings.Repeat(",1.5", elements-1) + `]}]}`
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest("POST", "/v2/models/example/infer", strings.NewReader(body)))
+	if w.Code != http.StatusOK {
+		t.Fatalf("unexpected status %d: %s", w.Code, w.Body.String())
+	}
+
+	// only the first bytes of the request and response are kept
+	for _, expected := range []string{body[:16], w.Body.String()[:16]} {
+		event := <-payloadLog.queue
+		if d := cmp.Diff(expected, string(event.body)); d != "" || !event.truncated {
+			t.Errorf("expected %s event to be truncated, diff :%s", event.eventType, d)
+		}
+		if cap(event.body) > 64 {
+			t.Errorf("expected at most 64 bytes to be buffered, got %d", cap(event.body))
+		}
+		if err = payloadLog.send(context.Background(), event); err != nil {
+			t.Fatal(err)
+		}
+		if header := <-truncated; header != "true" {
+			t.Errorf("expected Ce-Truncated header to be true, got %q", header)
+		}
+	}
+}
+
+func TestInferenceModelName(t *testing.T) {
+	tests := []struct {
+		path  string
+		model string
+		ok    bool
+	}{
+		{"/v2/models/example/infer", "example", true},
+		{"/v2/models/example/versions/1/infer", "example", true},
+		{"/v2/models/example/ready", "", false},
+		{"/v2/models/example/versions/1", "", false},
+		{"/v2/models/example/foo/1/infer", "", false},
+		{"/v1/models/example/infer", "", false},
+	}
+	for _, tt := range tests {
+		model, ok := inferenceModelName(tt.path)
+		if model != tt.model || ok != tt.ok {
+			t.Errorf("inferenceModelName(%q) = %q, %v, expected %q, %v", tt.path, model, ok, tt.model, tt.ok)
+		}
+	}
+}
@@ -0,0 +1,99 @@
+/*
+Copyright 2021 IBM Corporation
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"fmt"
+	"math"
+	"os"
+
+	gw "github.com/kserve/rest-proxy/gen"
+)
+
+// This file contains the range checks of input tensors whose datatype is
+// narrower than the int32 and uint32 gRPC contents they are sent as.
+
+const intOverflowEnvVar = "REST_PROXY_INT_OVERFLOW"
+
+type intOverflowPolicy string
+
+const (
+	REJECT_OVERFLOW   intOverflowPolicy = "reject"
+	SATURATE_OVERFLOW intOverflowPolicy = "saturate"
+	WRAP_OVERFLOW     intOverflowPolicy = "wrap"
+)
+
+// How out-of-range values of narrow integer input tensors are handled.
+var intOverflow = REJECT_OVERFLOW
+
+func getIntOverflowEnv() error {
+	policy := intOverflow
+	if val, ok := os.LookupEnv(intOverflowEnvVar); ok {
+		policy = intOverflowPolicy(val)
+	}
+	switch policy {
+	case REJECT_OVERFLOW, SATURATE_OVERFLOW, WRAP_OVERFLOW:
+		intOverflow = policy
+		return nil
+	default:
+		return fmt.Errorf("invalid %s %q, must be one of %s, %s or %s", intOverflowEnvVar, policy,
+			REJECT_OVERFLOW, SATURATE_OVERFLOW, WRAP_OVERFLOW)
+	}
+}
+
+type intRange struct {
+	min, max int64
+	wrap     func(int64) int64
+}
+
+var narrowIntRanges = map[string]intRange{
+	INT8:   {math.MinInt8, math.MaxInt8, func(v int64) int64 { return int64(int8(v)) }},
+	INT16:  {math.MinInt16, math.MaxInt16, func(v int64) int64 { return int64(int16(v)) }},
+	UINT8:  {0, math.MaxUint8, func(v int64) int64 { return int64(uint8(v)) }},
+	UINT16: {0, math.MaxUint16, func(v int64) int64 { return int64(uint16(v)) }},
+}
+
+// Sets the contents of a narrow integer tensor from the decoded values, handling
+// values outside the range of the datatype according to the overflow policy.
+func setNarrowIntContents(tensorName, dataType string, values []int64, contents *gw.InferTensorContents) error {
+	r := narrowIntRanges[dataType]
+	for i, v := range values {
+		if v >= r.min && v <= r.max {
+			continue
+		}
+		switch intOverflow {
+		case SATURATE_OVERFLOW:
+			values[i] = min(max(v, r.min), r.max)
+		case WRAP_OVERFLOW:
+			values[i] = r.wrap(v)
+		default:
+			return fmt.Errorf("element %d of input tensor %s is out of range for %s: %d", i, tensorName, dataType, v)
+		}
+	}
+	if r.min == 0 {
+		contents.UintContents = make([]uint32, len(values))
+		for i, v := range values {
+			contents.UintContents[i] = uint32(v)
+		}
+	} else {
+		contents.IntContents = make([]int32, len(values))
+		for i, v := range values {
+			contents.IntContents[i] = int32(v)
+		}
+	}
+	return nil
+}
@@ -1,10 +1,13 @@
 package main
 
 import (
+	"bytes"
+	"encoding/binary"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
+	"reflect"
 
 	"github.com/grpc-ecosystem/grpc-gateway/v2/runtime"
 	gw "github.com/kserve/rest-proxy/gen"
@@ -17,32 +20,132 @@ func (c *CustomJSONPb) NewDecoder(r io.Reader) runtime.Decoder {
 		if !ok {
 			return c.JSONPb.NewDecoder(r).Decode(v)
 		}
-		logger.Info("Received REST inference request")
 		restReq := &RESTRequest{}
-		if err := json.NewDecoder(r).Decode(restReq); err != nil {
+		decoder := json.NewDecoder(r)
+		if err := decoder.Decode(restReq); err != nil {
 			return err
 		}
-		transformRequest(restReq, req)
-		return nil
+		// binary tensor data immediately follows the JSON inference header
+		data, err := io.ReadAll(io.MultiReader(decoder.Buffered(), r))
+		if err != nil {
+			return err
+		}
+		if restReq.hasBinaryData() {
+			restReq.binaryData = data
+		} else if len(bytes.TrimLeft(data, " \t\r\n")) != 0 {
+			// only whitespace may follow the JSON object, it can't be told
+			// apart from the padding of a JSON request body
+			return fmt.Errorf("request contains %d bytes of binary data not assigned to any input tensor", len(data))
+		}
+		return transformRequest(restReq, req)
 	})
 }
 
-func transformRequest(restReq *RESTRequest, req *gw.ModelInferRequest) {
+func transformRequest(restReq *RESTRequest, req *gw.ModelInferRequest) error {
 	req.Id = restReq.Id
 	req.Parameters = restReq.Parameters
-	req.Outputs = restReq.Outputs
+	req.Outputs = make([]*gw.ModelInferRequest_InferRequestedOutputTensor, len(restReq.Outputs))
+	for i, output := range restReq.Outputs {
+		req.Outputs[i] = &gw.ModelInferRequest_InferRequestedOutputTensor{
+			Name:       output.Name,
+			Parameters: output.Parameters,
+		}
+	}
 	req.Inputs = make([]*gw.ModelInferRequest_InferInputTensor, len(restReq.Inputs))
+	useRaw := restReq.binaryData != nil
 	for i := range restReq.Inputs {
 		req.Inputs[i] = (*gw.ModelInferRequest_InferInputTensor)(&restReq.Inputs[i])
+		useRaw = useRaw || req.Inputs[i].Datatype == FP16 || req.Inputs[i].Datatype == BF16
 	}
+	if useRaw {
+		// FP16, BF16 and binary data can only be sent as raw bytes, and
+		// raw_input_contents must then be used for all of the input tensors
+		binaryData := restReq.binaryData
+		req.RawInputContents = make([][]byte, len(req.Inputs))
+		for i, input := range req.Inputs {
+			size, isBinary, err := binaryDataSize(input)
+			if err != nil {
+				return err
+			}
+			var raw []byte
+			if isBinary {
+				if raw, binaryData, err = sliceBinaryData(input, size, binaryData); err != nil {
+					return err
+				}
+				delete(input.Parameters, BINARY_DATA_SIZE)
+			} else if raw, err = rawContents(input.Datatype, input.Name, input.Contents); err != nil {
+				return fmt.Errorf("error converting input tensor %s to raw contents: %w", input.Name, err)
+			}
+			req.RawInputContents[i] = raw
+			input.Contents = nil
+		}
+		if len(binaryData) != 0 {
+			return fmt.Errorf("request contains %d bytes of binary data not assigned to any input tensor",
+				len(binaryData))
+		}
+	}
+	return nil
 }
 
 type RESTRequest struct {
-	Id string `json:"id,omitempty"`
-	//TODO figure out how to handle request-level content type parameter
-	Parameters parameterMap                                       `json:"parameters,omitempty"`
-	Inputs     []InputTensor                                      `json:"inputs,omitempty"`
-	Outputs    []*gw.ModelInferRequest_InferRequestedOutputTensor `json:"outputs,omitempty"`
+	Id         string            `json:"id,omitempty"`
+	Parameters parameterMap      `json:"parameters,omitempty"`
+	Inputs     []InputTensor     `json:"inputs,omitempty"`
+	Outputs    []RequestedOutput `json:"outputs,omitempty"`
+
+	binaryData []byte
+}
+
+type restRequestJson struct {
+	Id         string            `json:"id,omitempty"`
+	Parameters parameterMap      `json:"parameters,omitempty"`
+	Inputs     []json.RawMessage `json:"inputs,omitempty"`
+	Outputs    []RequestedOutput `json:"outputs,omitempty"`
+}
+
+// The input tensors are decoded after the request-level parameters, which
+// provide the default content_type for tensors that don't specify one.
+func (r *RESTRequest) UnmarshalJSON(data []byte) error {
+	if err := checkJSONDepth(data); err != nil {
+		return err
+	}
+	rj := &restRequestJson{}
+	if err := json.Unmarshal(data, rj); err != nil {
+		return err
+	}
+	if err := checkInputCount(len(rj.Inputs)); err != nil {
+		return err
+	}
+	*r = RESTRequest{Id: rj.Id, Parameters: rj.Parameters, Outputs: rj.Outputs}
+	if rj.Inputs != nil {
+		r.Inputs = make([]InputTensor, len(rj.Inputs))
+		var elements int64
+		for i, input := range rj.Inputs {
+			if err := r.Inputs[i].unmarshalJSON(input, rj.Parameters); err != nil {
+				return err
+			}
+			// the shape was already checked when decoding the tensor
+			count, _ := checkTensorElements(r.Inputs[i].Name, r.Inputs[i].Shape)
+			if err := addRequestElements(&elements, count); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (r *RESTRequest) hasBinaryData() bool {
+	for i := range r.Inputs {
+		if _, ok := r.Inputs[i].Parameters[BINARY_DATA_SIZE]; ok {
+			return true
+		}
+	}
+	return false
+}
+
+type RequestedOutput struct {
+	Name       string       `json:"name"`
+	Parameters parameterMap `json:"parameters,omitempty"`
 }
 
 // Input tensors
@@ -62,23 +165,49 @@ type InputTensorData struct {
 }
 
 func (t *InputTensor) UnmarshalJSON(data []byte) error {
+	return t.unmarshalJSON(data, nil)
+}
+
+func (t *InputTensor) unmarshalJSON(data []byte, requestParameters parameterMap) error {
 	meta := InputTensorMeta{}
 	if err := json.Unmarshal(data, &meta); err != nil {
 		return err
 	}
+	// checked before the tensor data is decoded, as the shape determines how
+	// much memory is allocated for it
+	if _, err := checkTensorElements(meta.Name, meta.Shape); err != nil {
+		return err
+	}
 	contents := &gw.InferTensorContents{}
 	target, err := targetArray(meta.Datatype, meta.Name, contents)
 	if err != nil {
 		return err
 	}
-	isBytes := meta.Datatype == BYTES
-	itd := &InputTensorData{Data: tensorDataUnmarshaller{
-		target: target, shape: meta.Shape,
-		bytes: isBytes, b64: isBytes && isBase64Content(meta.Parameters),
-	}}
-	if err := json.Unmarshal(data, itd); err != nil {
-		return err
-	}
+	if _, ok := meta.Parameters[BINARY_DATA_SIZE]; !ok {
+		isBytes := meta.Datatype == BYTES
+		contentParameters := meta.Parameters
+		if _, ok := contentParameters[CONTENT_TYPE]; !ok {
+			contentParameters = requestParameters // request-level default
+		}
+		// narrow integers are decoded as int64 to check their range
+		var narrowInts []int64
+		_, isNarrowInt := narrowIntRanges[meta.Datatype]
+		if isNarrowInt {
+			target = &narrowInts
+		}
+		itd := &InputTensorData{Data: tensorDataUnmarshaller{
+			target: target, name: meta.Name, datatype: meta.Datatype, shape: meta.Shape,
+			bytes: isBytes, b64: isBytes && isBase64Content(contentParameters),
+		}}
+		if err := json.Unmarshal(data, itd); err != nil {
+			return err
+		}
+		if isNarrowInt {
+			if err := setNarrowIntContents(meta.Name, meta.Datatype, narrowInts, contents); err != nil {
+				return err
+			}
+		}
+	} // else the tensor data is provided in the binary section of the request
 	*t = InputTensor{
 		Name:       meta.Name,
 		Datatype:   meta.Datatype,
@@ -102,8 +231,9 @@ func targetArray(dataType, tensorName string, contents *gw.InferTensorContents)
 		return &contents.IntContents, nil
 	case INT64:
 		return &contents.Int64Contents, nil
-	case FP16:
-		return nil, fmt.Errorf("FP16 tensors not supported (response tensor %s)", tensorName) //TODO
+	case FP16, BF16:
+		// converted to raw bytes in transformRequest
+		return &contents.Fp64Contents, nil
 	case FP32:
 		return &contents.Fp32Contents, nil
 	case FP64:
@@ -111,15 +241,17 @@ func targetArray(dataType, tensorName string, contents *gw.InferTensorContents)
 	case BYTES:
 		return &contents.BytesContents, nil //TODO still need to figure this one out
 	default:
-		return nil, fmt.Errorf("unsupported datatype: %s", dataType)
+		return nil, unsupportedDatatypeError(dataType, tensorName)
 	}
 }
 
 type tensorDataUnmarshaller struct {
-	shape  []int64
-	bytes  bool
-	b64    bool
-	target interface{}
+	name     string
+	datatype string
+	shape    []int64
+	bytes    bool
+	b64      bool
+	target   interface{}
 }
 
 func (t *tensorDataUnmarshaller) UnmarshalJSON(data []byte) error {
@@ -127,7 +259,7 @@ func (t *tensorDataUnmarshaller) UnmarshalJSON(data []byte) error {
 		return unmarshalBytesJson(t.target.(*[][]byte), t.shape, t.b64, data)
 	}
 	if len(t.shape) <= 1 {
-		return json.Unmarshal(data, t.target) // single-dimension fast-path
+		return t.unmarshalFlat(data) // single-dimension fast-path
 	}
 	start := -1
 	for i, b := range data {
@@ -144,48 +276,176 @@ func (t *tensorDataUnmarshaller) UnmarshalJSON(data []byte) error {
 				return errors.New("invalid tensor data: not a json array")
 			}
 			// fast-path: flat array
-			return json.Unmarshal(data, t.target)
+			return t.unmarshalFlat(data)
 		}
 	}
 	// here we have nested arrays
-
-	//TODO handle strings / BYTES case
+	if err := checkNestedShape(t.name, t.shape, data); err != nil {
+		return err
+	}
+	if elementCount(t.shape) == 0 {
+		return json.Unmarshal([]byte("[]"), t.target) // only empty arrays, nothing to strip
+	}
 
 	// strip all the square brackets (update data slice in-place)
-	var o, c int
 	j := 1
 	for _, b := range data {
-		if b == '[' {
-			o++
-		} else if b == ']' {
-			c++
-		} else {
+		if b != '[' && b != ']' {
 			data[j] = b
 			j++
 		}
 	}
-	if o != c || o != expectedBracketCount(t.shape) {
+	data[j] = ']'
+	return t.unmarshalElements(data[:j+1])
+}
+
+// Unmarshals a flat array, checking that its length matches the tensor shape.
+func (t *tensorDataUnmarshaller) unmarshalFlat(data []byte) error {
+	if err := t.unmarshalElements(data); err != nil {
+		return err
+	}
+	length := int64(reflect.ValueOf(t.target).Elem().Len())
+	if expected := elementCount(t.shape); length != expected {
+		if len(t.shape) == 1 {
+			return shapeMismatchError(t.name, t.shape, "dimension 0 has length %d, expected %d", length, expected)
+		}
+		return shapeMismatchError(t.name, t.shape, "%d elements, expected %d", length, expected)
+	}
+	return nil
+}
+
+// Unmarshals a flat array into the target. If an element isn't a valid value
+// of the tensor datatype, the error identifies the element.
+func (t *tensorDataUnmarshaller) unmarshalElements(data []byte) error {
+	err := json.Unmarshal(data, t.target)
+	var typeErr *json.UnmarshalTypeError
+	if err == nil || !errors.As(err, &typeErr) {
+		return err
+	}
+	var elements []json.RawMessage
+	if json.Unmarshal(data, &elements) != nil {
+		return err
+	}
+	element := reflect.New(reflect.TypeOf(t.target).Elem().Elem())
+	for i, e := range elements {
+		if json.Unmarshal(e, element.Interface()) != nil {
+			return fmt.Errorf("element %d of input tensor %s is not a valid %s value: %s", i, t.name, t.datatype, e)
+		}
+	}
+	return err
+}
+
+// Checks that the nesting of the arrays matches the tensor shape, and that the
+// length of every array matches the corresponding dimension.
+func checkNestedShape(tensorName string, shape []int64, data []byte) error {
+	lengths := make([]int64, len(shape)) // length of the open array at each depth
+	depth := 0
+	inValue, inString, escaped := false, false, false
+	for _, b := range data {
+		if inString {
+			if escaped {
+				escaped = false
+			} else if b == '\\' {
+				escaped = true
+			} else if b == '"' {
+				inString = false
+			}
+			continue
+		}
+		switch {
+		case b == '[':
+			if depth == len(shape) {
+				return shapeMismatchError(tensorName, shape, "arrays are nested deeper than %d dimensions", len(shape))
+			}
+			if depth > 0 {
+				lengths[depth-1]++
+			}
+			lengths[depth] = 0
+			depth++
+		case b == ']':
+			if depth == 0 {
+				return errors.New("invalid tensor data: invalid nested json arrays")
+			}
+			if lengths[depth-1] != shape[depth-1] {
+				return shapeMismatchError(tensorName, shape, "dimension %d has length %d, expected %d",
+					depth-1, lengths[depth-1], shape[depth-1])
+			}
+			depth--
+			inValue = false
+		case b == ',' || isSpace(b):
+			inValue = false
+		case !inValue:
+			if depth == 0 {
+				return errors.New("invalid tensor data: invalid nested json arrays")
+			}
+			if depth < len(shape) {
+				return shapeMismatchError(tensorName, shape, "dimension %d contains a value instead of an array", depth-1)
+			}
+			lengths[depth-1]++
+			inValue = true
+			inString = b == '"'
+		}
+	}
+	if depth != 0 {
 		return errors.New("invalid tensor data: invalid nested json arrays")
 	}
-	data[j] = ']'
-	return json.Unmarshal(data[:j+1], t.target)
+	return nil
 }
 
-func isSpace(c byte) bool {
-	return c <= ' ' && (c == ' ' || c == '\t' || c == '\r' || c == '\n')
+func shapeMismatchError(tensorName string, shape []int64, format string, args ...interface{}) error {
+	return fmt.Errorf("data of input tensor %s does not match shape %v: %s", tensorName, shape, fmt.Sprintf(format, args...))
 }
 
-func expectedBracketCount(shape []int64) int {
-	n := len(shape) - 1
-	if n < 1 {
-		return 1
+// Serializes the typed contents of a tensor to the little-endian raw representation.
+func rawContents(dataType, tensorName string, contents *gw.InferTensorContents) ([]byte, error) {
+	var data interface{}
+	switch dataType {
+	case BOOL:
+		data = contents.GetBoolContents()
+	case UINT8:
+		data = convertSlice[uint8](contents.GetUintContents())
+	case UINT16:
+		data = convertSlice[uint16](contents.GetUintContents())
+	case UINT32:
+		data = contents.GetUintContents()
+	case UINT64:
+		data = contents.GetUint64Contents()
+	case INT8:
+		data = convertSlice[int8](contents.GetIntContents())
+	case INT16:
+		data = convertSlice[int16](contents.GetIntContents())
+	case INT32:
+		data = contents.GetIntContents()
+	case INT64:
+		data = contents.GetInt64Contents()
+	case FP16, BF16:
+		return encode16BitFloats(dataType, contents.GetFp64Contents())
+	case FP32:
+		data = contents.GetFp32Contents()
+	case FP64:
+		data = contents.GetFp64Contents()
+	case BYTES:
+		return joinRawBytes(contents.GetBytesContents()), nil
+	default:
+		return nil, unsupportedDatatypeError(dataType, tensorName)
+	}
+	buf := &bytes.Buffer{}
+	if err := binary.Write(buf, binary.LittleEndian, data); err != nil {
+		return nil, err
 	}
-	p, s := 1, 1
-	for i := 0; i < n; i++ {
-		p *= int(shape[i])
-		s += p
+	return buf.Bytes(), nil
+}
+
+func convertSlice[T, S int8 | int16 | int32 | uint8 | uint16 | uint32](s []S) []T {
+	t := make([]T, len(s))
+	for i, v := range s {
+		t[i] = T(v)
 	}
-	return s
+	return t
+}
+
+func isSpace(c byte) bool {
+	return c <= ' ' && (c == ' ' || c == '\t' || c == '\r' || c == '\n')
 }
 
 // Input parameters
@@ -267,3 +267,293 @@ func TestBytesRESTRequest(t *testing.T) {
 	}
 
 }
+
+func TestRequestLevelContentTypeRESTRequest(t *testing.T) {
+	c := CustomJSONPb{}
+	// the inputs precede the request-level parameters to check that decoding doesn't depend on the field order
+	restReq := `{
+	"inputs": [{
+		"name": "encoded", "shape": [1], "datatype": "BYTES", "data": ["aGVsbG8="]
+	}, {
+		"name": "text", "shape": [1], "datatype": "BYTES", "data": ["aGVsbG8="], "parameters": {"content_type": "str"}
+	}],
+	"parameters": {"content_type": "base64"}
+	}`
+	out := &gw.ModelInferRequest{}
+	if err := c.NewDecoder(strings.NewReader(restReq)).Decode(out); err != nil {
+		t.Fatal(err)
+	}
+	expected := &gw.ModelInferRequest{
+		Parameters: map[string]*gw.InferParameter{
+			"content_type": {ParameterChoice: &gw.InferParameter_StringParam{StringParam: "base64"}},
+		},
+		Inputs: []*gw.ModelInferRequest_InferInputTensor{{
+			Name:     "encoded",
+			Datatype: "BYTES",
+			Shape:    []int64{1},
+			Contents: &gw.InferTensorContents{BytesContents: [][]byte{[]byte("hello")}},
+		}, {
+			Name:     "text",
+			Datatype: "BYTES",
+			Shape:    []int64{1},
+			Parameters: map[string]*gw.InferParameter{
+				"content_type": {ParameterChoice: &gw.InferParameter_StringParam{StringParam: "str"}},
+			},
+			Contents: &gw.InferTensorContents{BytesContents: [][]byte{[]byte("aGVsbG8=")}},
+		}},
+	}
+	if !proto.Equal(out, expected) {
+		t.Errorf("REST request failed to decode: %v != %v", out, expected)
+	}
+}
+
+func TestRawFloat16RESTRequest(t *testing.T) {
+	c := CustomJSONPb{}
+	buffer := bytes.NewBufferString(`{
+	"inputs": [{
+		"name": "image",
+		"shape": [2, 2],
+		"datatype": "FP16",
+		"data": [[1.0, 0.1], [-2, 65504]]
+	}, {
+		"name": "ids",
+		"shape": [2],
+		"datatype": "INT16",
+		"data": [-1, 258]
+	}, {
+		"name": "text",
+		"shape": [1],
+		"datatype": "BYTES",
+		"data": ["abc"]
+	}, {
+		"name": "embedding",
+		"shape": [3],
+		"datatype": "BF16",
+		"data": [1.0, 0.1, -2]
+	}]
+	}`)
+	out := &gw.ModelInferRequest{}
+	if err := c.NewDecoder(buffer).Decode(out); err != nil {
+		t.Error(err)
+	}
+
+	expected := &gw.ModelInferRequest{
+		Inputs: []*gw.ModelInferRequest_InferInputTensor{
+			{Name: "image", Datatype: "FP16", Shape: []int64{2, 2}},
+			{Name: "ids", Datatype: "INT16", Shape: []int64{2}},
+			{Name: "text", Datatype: "BYTES", Shape: []int64{1}},
+			{Name: "embedding", Datatype: "BF16", Shape: []int64{3}},
+		},
+		RawInputContents: [][]byte{
+			{0x00, 0x3c, 0x66, 0x2e, 0x00, 0xc0, 0xff, 0x7b},
+			{0xff, 0xff, 0x02, 0x01},
+			{0x03, 0x00, 0x00, 0x00, 'a', 'b', 'c'},
+			{0x80, 0x3f, 0xcd, 0x3d, 0x00, 0xc0},
+		},
+	}
+	if !proto.Equal(out, expected) {
+		t.Errorf("REST request failed to decode 16-bit float tensors: %v != %v", out, expected)
+	}
+}
+
+func TestUnsupportedDatatypeRESTRequest(t *testing.T) {
+	c := CustomJSONPb{}
+	buffer := bytes.NewBufferString(`{"inputs": [{"name": "x", "shape": [1], "datatype": "FP8", "data": [1]}]}`)
+	err := c.NewDecoder(buffer).Decode(&gw.ModelInferRequest{})
+	expected := "unsupported datatype FP8 for tensor x, supported datatypes are: " +
+		"BOOL, UINT8, UINT16, UINT32, UINT64, INT8, INT16, INT32, INT64, FP16, BF16, FP32, FP64, BYTES"
+	if err == nil || err.Error() != expected {
+		t.Errorf("expected error %q, got %v", expected, err)
+	}
+}
+
+func TestBinaryDataRESTRequest(t *testing.T) {
+	c := CustomJSONPb{}
+	header := `{
+	"id": "foo",
+	"inputs": [{
+		"name": "image",
+		"shape": [2, 2],
+		"datatype": "UINT8",
+		"parameters": {"binary_data_size": 4}
+	}, {
+		"name": "scale",
+		"shape": [1],
+		"datatype": "FP32",
+		"data": [0.5]
+	}, {
+		"name": "text",
+		"shape": [1],
+		"datatype": "BYTES",
+		"parameters": {"binary_data_size": 7}
+	}]
+	}`
+	binaryData := []byte{' ', 0x01, 0x02, '{', 0x03, 0x00, 0x00, 0x00, 'a', 'b', 'c'}
+	out := &gw.ModelInferRequest{}
+	if err := c.NewDecoder(bytes.NewReader(append([]byte(header), binaryData...))).Decode(out); err != nil {
+		t.Error(err)
+	}
+
+	expected := &gw.ModelInferRequest{
+		Id: "foo",
+		Inputs: []*gw.ModelInferRequest_InferInputTensor{
+			{Name: "image", Datatype: "UINT8", Shape: []int64{2, 2}, Parameters: map[string]*gw.InferParameter{}},
+			{Name: "scale", Datatype: "FP32", Shape: []int64{1}},
+			{Name: "text", Datatype: "BYTES", Shape: []int64{1}, Parameters: map[string]*gw.InferParameter{}},
+		},
+		RawInputContents: [][]byte{
+			{' ', 0x01, 0x02, '{'},
+			{0x00, 0x00, 0x00, 0x3f},
+			{0x03, 0x00, 0x00, 0x00, 'a', 'b', 'c'},
+		},
+	}
+	if !proto.Equal(out, expected) {
+		t.Errorf("REST request failed to decode binary tensor data: %v != %v", out, expected)
+	}
+}
+
+func TestInvalidBinaryDataRESTRequest(t *testing.T) {
+	tests := []struct {
+		shape    string
+		size     string
+		data     []byte
+		expected string
+	}{
+		{"[2]", "2", []byte{1, 2}, "binary_data_size 2 of input tensor x does not match the 8 bytes expected for shape [2]"},
+		{"[2]", "8", []byte{1, 2}, "binary_data_size 8 of input tensor x exceeds the remaining binary data (2 bytes)"},
+		{"[1]", "4", []byte{1, 2, 3, 4, 5}, "request contains 1 bytes of binary data not assigned to any input tensor"},
+		{"[1]", `"4"`, []byte{1, 2, 3, 4}, "binary_data_size parameter of input tensor x must be a non-negative integer"},
+	}
+	for _, test := range tests {
+		c := CustomJSONPb{}
+		header := `{"inputs": [{"name": "x", "shape": ` + test.shape + `, "datatype": "INT32", "parameters": {"binary_data_size": ` + test.size + `}}]}`
+		err := c.NewDecoder(bytes.NewReader(append([]byte(header), test.data...))).Decode(&gw.ModelInferRequest{})
+		if err == nil || err.Error() != test.expected {
+			t.Errorf("expected error %q, got %v", test.expected, err)
+		}
+	}
+}
+
+func TestShapeMismatchRESTRequest(t *testing.T) {
+	tests := []struct {
+		shape    string
+		data     string
+		expected string
+	}{
+		{"[3]", "[1, 2]", "data of input tensor x does not match shape [3]: dimension 0 has length 2, expected 3"},
+		{"[2, 3]", "[1, 2, 3, 4, 5]", "data of input tensor x does not match shape [2 3]: 5 elements, expected 6"},
+		{"[2, 3]", "[[1, 2, 3], [4, 5]]", "data of input tensor x does not match shape [2 3]: dimension 1 has length 2, expected 3"},
+		{"[2, 3]", "[[1, 2], [3, 4], [5, 6]]", "data of input tensor x does not match shape [2 3]: dimension 1 has length 2, expected 3"},
+		{"[3, 2]", "[[1, 2], [3, 4]]", "data of input tensor x does not match shape [3 2]: dimension 0 has length 2, expected 3"},
+		{"[2, 2]", "[[1, 2], 3, 4]", "data of input tensor x does not match shape [2 2]: dimension 0 contains a value instead of an array"},
+		{"[1, 2]", "[[[1, 2]]]", "data of input tensor x does not match shape [1 2]: arrays are nested deeper than 2 dimensions"},
+		{"[2, 1, 2]", "[[[1, 2]], [[3]]]", "data of input tensor x does not match shape [2 1 2]: dimension 2 has length 1, expected 2"},
+	}
+	for _, test := range tests {
+		c := CustomJSONPb{}
+		body := `{"inputs": [{"name": "x", "shape": ` + test.shape + `, "datatype": "FP32", "data": ` + test.data + `}]}`
+		err := c.NewDecoder(strings.NewReader(body)).Decode(&gw.ModelInferRequest{})
+		if err == nil || err.Error() != test.expected {
+			t.Errorf("expected error %q, got %v", test.expected, err)
+		}
+	}
+
+	// arrays of every dimension matching the shape, including empty ones
+	for _, test := range []struct{ shape, data string }{
+		{"[2, 0]", "[[], []]"},
+		{"[0, 2]", "[]"},
+		{"[2, 1, 2]", "[[[1, 2]], [[3, 4]]]"},
+	} {
+		c := CustomJSONPb{}
+		body := `{"inputs": [{"name": "x", "shape": ` + test.shape + `, "datatype": "FP32", "data": ` + test.data + `}]}`
+		if err := c.NewDecoder(strings.NewReader(body)).Decode(&gw.ModelInferRequest{}); err != nil {
+			t.Errorf("unexpected error for shape %s and data %s: %v", test.shape, test.data, err)
+		}
+	}
+}
+
+func TestNarrowIntRESTRequest(t *testing.T) {
+	tests := []struct {
+		datatype string
+		data     string
+		policy   intOverflowPolicy
+		expected *gw.InferTensorContents
+		err      string
+	}{
+		{INT8, "[-128, 0, 127]", REJECT_OVERFLOW, &gw.InferTensorContents{IntContents: []int32{-128, 0, 127}}, ""},
+		{INT8, "[1, 128, 0]", REJECT_OVERFLOW, nil, "element 1 of input tensor x is out of range for INT8: 128"},
+		{INT16, "[1, 2, -32769]", REJECT_OVERFLOW, nil, "element 2 of input tensor x is out of range for INT16: -32769"},
+		{UINT8, "[300, 2, 3]", REJECT_OVERFLOW, nil, "element 0 of input tensor x is out of range for UINT8: 300"},
+		{UINT16, "[1, -1, 3]", REJECT_OVERFLOW, nil, "element 1 of input tensor x is out of range for UINT16: -1"},
+		{UINT8, "[1, 2.5, 3]", REJECT_OVERFLOW, nil, "element 1 of input tensor x is not a valid UINT8 value: 2.5"},
+		{INT32, "[1, 2, 2147483648]", REJECT_OVERFLOW, nil, "element 2 of input tensor x is not a valid INT32 value: 2147483648"},
+		{BOOL, "[true, 1, false]", REJECT_OVERFLOW, nil, `element 1 of input tensor x is not a valid BOOL value: 1`},
+		{INT8, "[-200, 5, 200]", SATURATE_OVERFLOW, &gw.InferTensorContents{IntContents: []int32{-128, 5, 127}}, ""},
+		{UINT16, "[-1, 5, 70000]", SATURATE_OVERFLOW, &gw.InferTensorContents{UintContents: []uint32{0, 5, 65535}}, ""},
+		{INT8, "[-129, 5, 128]", WRAP_OVERFLOW, &gw.InferTensorContents{IntContents: []int32{127, 5, -128}}, ""},
+		{UINT8, "[-1, 5, 256]", WRAP_OVERFLOW, &gw.InferTensorContents{UintContents: []uint32{255, 5, 0}}, ""},
+	}
+	prev := intOverflow
+	defer func() { intOverflow = prev }()
+	for _, test := range tests {
+		intOverflow = test.policy
+		c := CustomJSONPb{}
+		body := `{"inputs": [{"name": "x", "shape": [3], "datatype": "` + test.datatype + `", "data": ` + test.data + `}]}`
+		out := &gw.ModelInferRequest{}
+		err := c.NewDecoder(strings.NewReader(body)).Decode(out)
+		if test.err != "" {
+			if err == nil || err.Error() != test.err {
+				t.Errorf("expected error %q, got %v", test.err, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("unexpected error for %s data %s: %v", test.datatype, test.data, err)
+		} else if !proto.Equal(out.Inputs[0].Contents, test.expected) {
+			t.Errorf("%s data %s decoded to %v, expected %v", test.datatype, test.data, out.Inputs[0].Contents, test.expected)
+		}
+	}
+}
+
+func TestFloat16OverflowRESTRequest(t *testing.T) {
+	tests := []struct {
+		datatype string
+		data     string
+		expected string
+	}{
+		{FP16, "[65519, 65520]", "error converting input tensor x to raw contents: element 1 overflows FP16: 65520"},
+		{FP16, "[-70000, 1]", "error converting input tensor x to raw contents: element 0 overflows FP16: -70000"},
+		{BF16, "[1, 1e39]", "error converting input tensor x to raw contents: element 1 overflows BF16: 1e+39"},
+		{BF16, "[-1e39, 1]", "error converting input tensor x to raw contents: element 0 overflows BF16: -1e+39"},
+	}
+	for _, test := range tests {
+		c := CustomJSONPb{}
+		body := `{"inputs": [{"name": "x", "shape": [2], "datatype": "` + test.datatype + `", "data": ` + test.data + `}]}`
+		err := c.NewDecoder(strings.NewReader(body)).Decode(&gw.ModelInferRequest{})
+		if err == nil || err.Error() != test.expected {
+			t.Errorf("expected error %q, got %v", test.expected, err)
+		}
+	}
+}
+
+func TestUnclaimedBinaryDataRESTRequest(t *testing.T) {
+	header := `{"inputs": [{"name": "x", "shape": [1], "datatype": "INT32", "data": [1]}]}`
+	tests := []struct {
+		data     []byte
+		expected string
+	}{
+		{[]byte{1, 2, 3, 4}, "request contains 4 bytes of binary data not assigned to any input tensor"},
+		{[]byte("\n"), ""},
+	}
+	for _, test := range tests {
+		c := CustomJSONPb{}
+		err := c.NewDecoder(bytes.NewReader(append([]byte(header), test.data...))).Decode(&gw.ModelInferRequest{})
+		if test.expected == "" {
+			if err != nil {
+				t.Errorf("unexpected error for trailing data %q: %v", test.data, err)
+			}
+		} else if err == nil || err.Error() != test.expected {
+			t.Errorf("expected error %q, got %v", test.expected, err)
+		}
+	}
+}
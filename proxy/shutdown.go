@@ -0,0 +1,72 @@
+/*
+Copyright 2021 IBM Corporation
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	shutdownDelayEnvVar   = "REST_PROXY_SHUTDOWN_DELAY"
+	shutdownTimeoutEnvVar = "REST_PROXY_SHUTDOWN_TIMEOUT"
+)
+
+// Counts the requests being served, to report how many were drained or cut off
+// on shutdown.
+type requestTracker struct {
+	inFlight atomic.Int64
+}
+
+func (t *requestTracker) handler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.inFlight.Add(1)
+		defer t.inFlight.Add(-1)
+		next.ServeHTTP(w, r)
+	})
+}
+
+// Shuts the server down gracefully. The readiness probe fails first so that no
+// new requests are routed to the proxy, and after the delay the server stops
+// accepting connections and waits up to the timeout for in-flight requests to
+// complete. Any requests still in flight after the timeout are cut off.
+func shutdownServer(server *http.Server, tracker *requestTracker, probe *backendProbe,
+	delay, timeout time.Duration) (drained, cutOff int64, err error) {
+	probe.shuttingDown.Store(true)
+	if delay > 0 {
+		logger.Info("Waiting before shutting down the server", "delay", delay.String())
+		time.Sleep(delay)
+	}
+
+	inFlight := tracker.inFlight.Load()
+	logger.Info("Shutting down the server", "inFlight", inFlight, "timeout", timeout.String())
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	if err = server.Shutdown(ctx); err != nil {
+		cutOff = tracker.inFlight.Load()
+		if errors.Is(err, context.DeadlineExceeded) {
+			err = server.Close()
+		}
+	}
+	if drained = inFlight - cutOff; drained < 0 {
+		drained = 0 // may be negative if requests were still arriving during the shutdown
+	}
+	return drained, cutOff, err
+}
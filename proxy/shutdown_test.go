@@ -0,0 +1,92 @@
+/*
+Copyright 2021 IBM Corporation
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"net"
+	"net/http"
+	"testing"
+	"time"
+)
+
+// Starts a server whose handler blocks until the release channel is closed,
+// and a request to it, returning once the request is in flight.
+func startBlockedRequest(t *testing.T, tracker *requestTracker, release chan struct{}) (*http.Server, chan error) {
+	t.Helper()
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := &http.Server{Handler: tracker.handler(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {
+		<-release
+	}))}
+	go server.Serve(lis)
+
+	result := make(chan error, 1)
+	go func() {
+		resp, err := http.Get("http://" + lis.Addr().String())
+		if err == nil {
+			resp.Body.Close()
+		}
+		result <- err
+	}()
+	for deadline := time.Now().Add(5 * time.Second); tracker.inFlight.Load() == 0; time.Sleep(time.Millisecond) {
+		if time.Now().After(deadline) {
+			t.Fatal("timed out waiting for request")
+		}
+	}
+	return server, result
+}
+
+func TestShutdownDrainsRequests(t *testing.T) {
+	tracker, probe := &requestTracker{}, &backendProbe{}
+	release := make(chan struct{})
+	server, result := startBlockedRequest(t, tracker, release)
+	time.AfterFunc(50*time.Millisecond, func() { close(release) })
+
+	drained, cutOff, err := shutdownServer(server, tracker, probe, 10*time.Millisecond, 5*time.Second)
+	if err != nil {
+		t.Error(err)
+	}
+	if drained != 1 || cutOff != 0 {
+		t.Errorf("expected 1 drained and 0 cut off requests, got %d and %d", drained, cutOff)
+	}
+	if !probe.shuttingDown.Load() {
+		t.Error("expected readiness to be flipped")
+	}
+	if err = <-result; err != nil {
+		t.Errorf("expected drained request to succeed: %v", err)
+	}
+}
+
+func TestShutdownCutsOffRequests(t *testing.T) {
+	tracker, probe := &requestTracker{}, &backendProbe{}
+	release := make(chan struct{})
+	defer close(release)
+	server, result := startBlockedRequest(t, tracker, release)
+
+	drained, cutOff, err := shutdownServer(server, tracker, probe, 0, 50*time.Millisecond)
+	if err != nil {
+		t.Error(err)
+	}
+	if drained != 0 || cutOff != 1 {
+		t.Errorf("expected 0 drained and 1 cut off requests, got %d and %d", drained, cutOff)
+	}
+	if err = <-result; err == nil {
+		t.Error("expected cut off request to fail")
+	}
+}
@@ -0,0 +1,248 @@
+/*
+Copyright 2021 IBM Corporation
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/metadata"
+)
+
+const (
+	restProxyGrpcCAEnvVar         = "REST_PROXY_GRPC_TLS_CA_CERT_PATH"
+	restProxyGrpcCertEnvVar       = "REST_PROXY_GRPC_TLS_CERT_PATH"
+	restProxyGrpcKeyEnvVar        = "REST_PROXY_GRPC_TLS_KEY_PATH"
+	restProxyGrpcServerNameEnvVar = "REST_PROXY_GRPC_TLS_SERVER_NAME"
+	tlsClientCAEnvVar             = "REST_PROXY_TLS_CLIENT_CA_CERT_PATH"
+	tlsClientAuthEnvVar           = "REST_PROXY_TLS_CLIENT_AUTH"
+	tlsMinVersionEnvVar           = "REST_PROXY_TLS_MIN_VERSION"
+	tlsCipherSuitesEnvVar         = "REST_PROXY_TLS_CIPHER_SUITES"
+
+	// gRPC metadata key used to pass the subject of a verified REST client certificate
+	CLIENT_CERT_SUBJECT = "rest-proxy-client-cert-subject"
+)
+
+var tlsVersions = map[string]uint16{
+	"1.0": tls.VersionTLS10,
+	"1.1": tls.VersionTLS11,
+	"1.2": tls.VersionTLS12,
+	"1.3": tls.VersionTLS13,
+}
+
+// Builds the transport credentials of the connection to the gRPC server. By
+// default the system trust store is used to verify the server certificate, a CA
+// bundle can be provided instead, along with a client certificate for mutual TLS
+// and the server name used for SNI and verification. These files are reloaded by
+// the certWatcher when they change.
+func grpcClientCredentials(w *certWatcher) (credentials.TransportCredentials, error) {
+	config := &tls.Config{}
+	if skipVerify, ok := os.LookupEnv(restProxySkipVerifyEnvVar); ok {
+		skipVerifyBool, err := strconv.ParseBool(skipVerify)
+		if err != nil {
+			logger.Error(err, "Failed to parse environment variable to bool", "env", restProxySkipVerifyEnvVar, "value", skipVerify)
+		}
+		config.InsecureSkipVerify = skipVerifyBool
+	}
+	var roots *reloadable[x509.CertPool]
+	if caPath := os.Getenv(restProxyGrpcCAEnvVar); caPath != "" && !config.InsecureSkipVerify {
+		var err error
+		if roots, err = w.certPool("gRPC CA certificates", caPath); err != nil {
+			return nil, err
+		}
+	}
+	certPath, keyPath := os.Getenv(restProxyGrpcCertEnvVar), os.Getenv(restProxyGrpcKeyEnvVar)
+	if certPath != "" || keyPath != "" {
+		if certPath == "" || keyPath == "" {
+			return nil, fmt.Errorf("both %s and %s must be set to use a client certificate",
+				restProxyGrpcCertEnvVar, restProxyGrpcKeyEnvVar)
+		}
+		cert, err := w.keyPair("gRPC client certificate", certPath, keyPath)
+		if err != nil {
+			return nil, err
+		}
+		config.GetClientCertificate = func(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+			return cert.Load(), nil
+		}
+	}
+	config.ServerName = os.Getenv(restProxyGrpcServerNameEnvVar)
+	if roots == nil {
+		return credentials.NewTLS(config), nil
+	}
+	return &caBundleCredentials{TransportCredentials: credentials.NewTLS(config), config: config, roots: roots}, nil
+}
+
+// Transport credentials verifying the server certificate against the current CA
+// bundle, since RootCAs can't be swapped once a config is in use. The certificate
+// must match the configured server name, or else the host or IP address of the
+// authority the connection was dialed with.
+type caBundleCredentials struct {
+	credentials.TransportCredentials
+	config *tls.Config
+	roots  *reloadable[x509.CertPool]
+}
+
+func (c *caBundleCredentials) ClientHandshake(ctx context.Context, authority string,
+	conn net.Conn) (net.Conn, credentials.AuthInfo, error) {
+	config := c.config.Clone()
+	name := config.ServerName
+	if name == "" {
+		var err error
+		if name, _, err = net.SplitHostPort(authority); err != nil {
+			name = authority // no port
+		}
+	}
+	roots := c.roots.Load()
+	config.InsecureSkipVerify = true
+	config.VerifyConnection = func(cs tls.ConnectionState) error {
+		return verifyPeerCertificate(cs, name, roots)
+	}
+	return credentials.NewTLS(config).ClientHandshake(ctx, authority, conn)
+}
+
+func (c *caBundleCredentials) Clone() credentials.TransportCredentials {
+	return &caBundleCredentials{TransportCredentials: c.TransportCredentials.Clone(), config: c.config, roots: c.roots}
+}
+
+// Performs the same verification as the TLS client would with the given RootCAs
+// and server name, which may be a host name or an IP address.
+func verifyPeerCertificate(cs tls.ConnectionState, name string, roots *x509.CertPool) error {
+	if len(cs.PeerCertificates) == 0 {
+		return errors.New("no server certificate provided")
+	}
+	if name == "" {
+		return errors.New("no server name to verify the server certificate against")
+	}
+	opts := x509.VerifyOptions{
+		Roots:         roots,
+		DNSName:       name,
+		Intermediates: x509.NewCertPool(),
+	}
+	for _, cert := range cs.PeerCertificates[1:] {
+		opts.Intermediates.AddCert(cert)
+	}
+	_, err := cs.PeerCertificates[0].Verify(opts)
+	return err
+}
+
+// Builds the TLS configuration of the HTTPS listener. Client certificates are
+// verified against the CA bundle if one is provided, in which case they are
+// required unless REST_PROXY_TLS_CLIENT_AUTH is set to verify-if-given, or to
+// none to disable client authentication even if a CA bundle is set. The
+// certificate and CA bundle are reloaded by the certWatcher when they change.
+func serverTLSConfig(w *certWatcher, certPath, keyPath string) (*tls.Config, error) {
+	cert, err := w.keyPair("TLS certificate", certPath, keyPath)
+	if err != nil {
+		return nil, err
+	}
+	config := &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		GetCertificate: func(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+			return cert.Load(), nil
+		},
+	}
+	if v := os.Getenv(tlsMinVersionEnvVar); v != "" {
+		version, ok := tlsVersions[v]
+		if !ok {
+			return nil, fmt.Errorf("invalid %s %s, must be one of 1.0, 1.1, 1.2, 1.3", tlsMinVersionEnvVar, v)
+		}
+		config.MinVersion = version
+	}
+	if names := os.Getenv(tlsCipherSuitesEnvVar); names != "" {
+		suites, err := parseCipherSuites(names)
+		if err != nil {
+			return nil, err
+		}
+		config.CipherSuites = suites
+	}
+
+	clientAuth := os.Getenv(tlsClientAuthEnvVar)
+	caPath := os.Getenv(tlsClientCAEnvVar)
+	if caPath == "" {
+		if clientAuth != "" && clientAuth != "none" {
+			return nil, fmt.Errorf("%s must be set when %s is %s", tlsClientCAEnvVar, tlsClientAuthEnvVar, clientAuth)
+		}
+		return config, nil
+	}
+	switch clientAuth {
+	case "", "require":
+		config.ClientAuth = tls.RequireAndVerifyClientCert
+	case "verify-if-given":
+		config.ClientAuth = tls.VerifyClientCertIfGiven
+	case "none":
+		// client certificates are neither requested nor verified
+		return config, nil
+	default:
+		return nil, fmt.Errorf("invalid %s %s, must be one of require, verify-if-given, none",
+			tlsClientAuthEnvVar, clientAuth)
+	}
+	pool, err := w.certPool("TLS client CA certificates", caPath)
+	if err != nil {
+		return nil, err
+	}
+	config.ClientCAs = pool.Load()
+	config.GetConfigForClient = func(*tls.ClientHelloInfo) (*tls.Config, error) {
+		if current := pool.Load(); current != config.ClientCAs {
+			c := config.Clone()
+			c.ClientCAs = current
+			return c, nil
+		}
+		return nil, nil // use the original config
+	}
+	return config, nil
+}
+
+// Parses a comma-separated list of cipher suite names as defined by crypto/tls,
+// e.g. TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256. These only apply to TLS 1.2 and
+// earlier, TLS 1.3 cipher suites are not configurable.
+func parseCipherSuites(names string) ([]uint16, error) {
+	supported := make(map[string]uint16)
+	for _, suite := range tls.CipherSuites() {
+		supported[suite.Name] = suite.ID
+	}
+	var suites []uint16
+	for _, name := range strings.Split(names, ",") {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			continue
+		}
+		id, ok := supported[name]
+		if !ok {
+			return nil, fmt.Errorf("unsupported cipher suite %s in %s", name, tlsCipherSuitesEnvVar)
+		}
+		suites = append(suites, id)
+	}
+	return suites, nil
+}
+
+// This function is registered as a metadata annotator to pass the subject of
+// a verified client certificate to the gRPC server.
+func clientCertMetadata(_ context.Context, r *http.Request) metadata.MD {
+	if r.TLS == nil || len(r.TLS.VerifiedChains) == 0 || len(r.TLS.VerifiedChains[0]) == 0 {
+		return nil
+	}
+	return metadata.Pairs(CLIENT_CERT_SUBJECT, r.TLS.VerifiedChains[0][0].Subject.String())
+}
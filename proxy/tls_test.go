@@ -0,0 +1,302 @@
+/*
+Copyright 2021 IBM Corporation
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/metadata"
+)
+
+type testCert struct {
+	cert     *x509.Certificate
+	key      *ecdsa.PrivateKey
+	certPath string
+	keyPath  string
+}
+
+// Writes a certificate and key signed by the given CA, or a self-signed CA
+// certificate if ca is nil, to PEM files in the given directory.
+func writeTestCert(t *testing.T, dir, name string, ca *testCert) *testCert {
+	t.Helper()
+	return writeTestCertWithIPs(t, dir, name, ca, []net.IP{net.IPv4(127, 0, 0, 1)})
+}
+
+// Writes a certificate like writeTestCert, with the given IP address SANs.
+func writeTestCertWithIPs(t *testing.T, dir, name string, ca *testCert, ips []net.IP) *testCert {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: name},
+		DNSNames:     []string{name},
+		IPAddresses:  ips,
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+	}
+	parent, signer := template, key
+	if ca == nil {
+		template.IsCA = true
+		template.BasicConstraintsValid = true
+		template.KeyUsage |= x509.KeyUsageCertSign
+	} else {
+		parent, signer = ca.cert, ca.key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, parent, &key.PublicKey, signer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDer, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tc := &testCert{cert: cert, key: key,
+		certPath: filepath.Join(dir, name+".crt"), keyPath: filepath.Join(dir, name+".key")}
+	if err = os.WriteFile(tc.certPath, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err = os.WriteFile(tc.keyPath, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDer}), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return tc
+}
+
+func mustParseLeaf(t *testing.T, der []byte) *x509.Certificate {
+	t.Helper()
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cert
+}
+
+// Starts an HTTPS server requiring client certificates signed by the given CA.
+func startTLSServer(t *testing.T, server, ca *testCert) *httptest.Server {
+	t.Helper()
+	cert, err := tls.LoadX509KeyPair(server.certPath, server.keyPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pool := x509.NewCertPool()
+	pool.AddCert(ca.cert)
+	ts := httptest.NewUnstartedServer(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {}))
+	ts.TLS = &tls.Config{Certificates: []tls.Certificate{cert}, ClientCAs: pool, ClientAuth: tls.RequireAndVerifyClientCert}
+	ts.EnableHTTP2 = true // gRPC clients only negotiate h2
+	ts.StartTLS()
+	t.Cleanup(ts.Close)
+	return ts
+}
+
+func tlsGet(config *tls.Config, url string) error {
+	resp, err := (&http.Client{Transport: &http.Transport{TLSClientConfig: config}}).Get(url)
+	if err == nil {
+		resp.Body.Close()
+	}
+	return err
+}
+
+// Performs a TLS handshake with the server at the given address, as the gRPC
+// client does when dialing the given authority.
+func tlsHandshake(creds credentials.TransportCredentials, addr, authority string) error {
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		return err
+	}
+	tlsConn, _, err := creds.ClientHandshake(context.Background(), authority, conn)
+	if err != nil {
+		conn.Close()
+		return err
+	}
+	return tlsConn.Close()
+}
+
+func TestGrpcClientCredentials(t *testing.T) {
+	dir := t.TempDir()
+	ca := writeTestCert(t, dir, "ca", nil)
+	client := writeTestCert(t, dir, "client", ca)
+	ts := startTLSServer(t, writeTestCert(t, dir, "model-server", ca), ca)
+	addr := ts.Listener.Addr().String()
+	_, port, _ := net.SplitHostPort(addr)
+
+	t.Setenv(restProxyGrpcCAEnvVar, ca.certPath)
+	t.Setenv(restProxyGrpcCertEnvVar, client.certPath)
+	t.Setenv(restProxyGrpcKeyEnvVar, client.keyPath)
+	t.Setenv(restProxyGrpcServerNameEnvVar, "model-server")
+	creds, err := grpcClientCredentials(&certWatcher{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = tlsHandshake(creds, addr, addr); err != nil {
+		t.Errorf("expected mutual TLS connection to succeed: %v", err)
+	}
+
+	// the server certificate must match the server name
+	t.Setenv(restProxyGrpcServerNameEnvVar, "other-server")
+	if creds, err = grpcClientCredentials(&certWatcher{}); err != nil {
+		t.Fatal(err)
+	}
+	if err = tlsHandshake(creds, addr, addr); err == nil {
+		t.Error("expected connection with wrong server name to fail")
+	}
+
+	// without a server name, the certificate must match the dialed IP address or host
+	t.Setenv(restProxyGrpcServerNameEnvVar, "")
+	if creds, err = grpcClientCredentials(&certWatcher{}); err != nil {
+		t.Fatal(err)
+	}
+	if err = tlsHandshake(creds, addr, addr); err != nil {
+		t.Errorf("expected connection to an IP address SAN to succeed: %v", err)
+	}
+	noIP := startTLSServer(t, writeTestCertWithIPs(t, dir, "noip", ca, nil), ca)
+	noIPAddr := noIP.Listener.Addr().String()
+	if err = tlsHandshake(creds, noIPAddr, noIPAddr); err == nil {
+		t.Error("expected connection to an IP address without a matching SAN to fail")
+	}
+	if err = tlsHandshake(creds, noIPAddr, "noip:"+port); err != nil {
+		t.Errorf("expected connection to a host name SAN to succeed: %v", err)
+	}
+
+	t.Setenv(restProxyGrpcKeyEnvVar, "")
+	if _, err = grpcClientCredentials(&certWatcher{}); err == nil {
+		t.Error("expected error for client certificate without key")
+	}
+
+	t.Setenv(restProxyGrpcCertEnvVar, "")
+	t.Setenv(restProxyGrpcCAEnvVar, client.keyPath)
+	if _, err = grpcClientCredentials(&certWatcher{}); err == nil {
+		t.Error("expected error for invalid CA bundle")
+	}
+}
+
+func TestServerTLSConfig(t *testing.T) {
+	dir := t.TempDir()
+	ca := writeTestCert(t, dir, "ca", nil)
+	server := writeTestCert(t, dir, "localhost", ca)
+	client := writeTestCert(t, dir, "client", ca)
+
+	config, err := serverTLSConfig(&certWatcher{}, server.certPath, server.keyPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if config.ClientAuth != tls.NoClientCert || config.MinVersion != tls.VersionTLS12 {
+		t.Errorf("unexpected default config: %v %v", config.ClientAuth, config.MinVersion)
+	}
+
+	t.Setenv(tlsClientCAEnvVar, ca.certPath)
+	t.Setenv(tlsMinVersionEnvVar, "1.3")
+	if config, err = serverTLSConfig(&certWatcher{}, server.certPath, server.keyPath); err != nil {
+		t.Fatal(err)
+	}
+	if config.ClientAuth != tls.RequireAndVerifyClientCert || config.MinVersion != tls.VersionTLS13 {
+		t.Errorf("unexpected config: %v %v", config.ClientAuth, config.MinVersion)
+	}
+
+	// clients are verified by the HTTPS listener and their subject is passed on
+	var md metadata.MD
+	ts := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		md = clientCertMetadata(context.Background(), r)
+	}))
+	// not using StartTLS, which would add its own certificate to the config
+	ts.Listener = tls.NewListener(ts.Listener, config)
+	ts.Start()
+	defer ts.Close()
+	url := "https://" + ts.Listener.Addr().String()
+
+	clientCert, err := tls.LoadX509KeyPair(client.certPath, client.keyPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	clientConfig := &tls.Config{RootCAs: config.ClientCAs, Certificates: []tls.Certificate{clientCert}}
+	if err = tlsGet(clientConfig, url); err != nil {
+		t.Fatal(err)
+	}
+	if d := cmp.Diff([]string{"CN=client"}, md.Get(CLIENT_CERT_SUBJECT)); d != "" {
+		t.Errorf("diff :%s", d)
+	}
+
+	clientConfig.Certificates = nil
+	if err = tlsGet(clientConfig, url); err == nil {
+		t.Error("expected request without client certificate to fail")
+	}
+
+	t.Setenv(tlsClientAuthEnvVar, "verify-if-given")
+	if config, err = serverTLSConfig(&certWatcher{}, server.certPath, server.keyPath); err != nil {
+		t.Fatal(err)
+	}
+	if config.ClientAuth != tls.VerifyClientCertIfGiven {
+		t.Errorf("unexpected client auth %v", config.ClientAuth)
+	}
+
+	// no client certificates are requested when client auth is disabled
+	t.Setenv(tlsClientAuthEnvVar, "none")
+	if config, err = serverTLSConfig(&certWatcher{}, server.certPath, server.keyPath); err != nil {
+		t.Fatal(err)
+	}
+	if config.ClientAuth != tls.NoClientCert || config.ClientCAs != nil || config.GetConfigForClient != nil {
+		t.Errorf("unexpected client auth %v", config.ClientAuth)
+	}
+
+	for env, value := range map[string]string{
+		tlsClientAuthEnvVar:   "always",
+		tlsMinVersionEnvVar:   "1.4",
+		tlsCipherSuitesEnvVar: "TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256,TLS_FAKE",
+	} {
+		t.Run(env, func(t *testing.T) {
+			t.Setenv(env, value)
+			if _, err := serverTLSConfig(&certWatcher{}, server.certPath, server.keyPath); err == nil {
+				t.Errorf("expected error for %s=%s", env, value)
+			}
+		})
+	}
+}
+
+func TestParseCipherSuites(t *testing.T) {
+	suites, err := parseCipherSuites("TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256, TLS_ECDHE_ECDSA_WITH_AES_256_GCM_SHA384")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []uint16{tls.TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256, tls.TLS_ECDHE_ECDSA_WITH_AES_256_GCM_SHA384}
+	if d := cmp.Diff(expected, suites); d != "" {
+		t.Errorf("diff :%s", d)
+	}
+}
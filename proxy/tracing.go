@@ -0,0 +1,194 @@
+/*
+Copyright 2021 IBM Corporation
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/grpc-ecosystem/grpc-gateway/v2/runtime"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+
+	gw "github.com/kserve/rest-proxy/gen"
+)
+
+const (
+	tracingExporterEnvVar = "REST_PROXY_TRACING_EXPORTER"
+	tracingFileEnvVar     = "REST_PROXY_TRACING_FILE"
+
+	tracerName = "github.com/kserve/rest-proxy"
+)
+
+// Configures the OpenTelemetry tracer provider. Spans are exported with OTLP
+// over HTTP, configured by the standard OTEL_EXPORTER_OTLP_* environment
+// variables, or written as JSON to stdout or a file. The W3C trace context is
+// propagated to the gRPC server even if no exporter is configured. The returned
+// function flushes any remaining spans.
+func setupTracing(ctx context.Context) (func(context.Context) error, error) {
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
+
+	var exporter sdktrace.SpanExporter
+	var file *os.File
+	var err error
+	switch exp := os.Getenv(tracingExporterEnvVar); exp {
+	case "", "none":
+		return func(context.Context) error { return nil }, nil
+	case "otlp":
+		exporter, err = otlptracehttp.New(ctx)
+	case "stdout":
+		exporter, err = stdouttrace.New(stdouttrace.WithWriter(os.Stdout))
+	case "file":
+		if file, err = os.OpenFile(os.Getenv(tracingFileEnvVar), os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644); err == nil {
+			exporter, err = stdouttrace.New(stdouttrace.WithWriter(file))
+		}
+	default:
+		return nil, fmt.Errorf("invalid %s %s, must be one of otlp, stdout, file, none", tracingExporterEnvVar, exp)
+	}
+	if err != nil {
+		if file != nil {
+			file.Close()
+		}
+		return nil, fmt.Errorf("error creating trace exporter: %w", err)
+	}
+	// the service name can be set with OTEL_SERVICE_NAME and the sampler with OTEL_TRACES_SAMPLER
+	tp := sdktrace.NewTracerProvider(sdktrace.WithBatcher(exporter), sdktrace.WithResource(resource.Default()))
+	otel.SetTracerProvider(tp)
+	if file == nil {
+		return tp.Shutdown, nil
+	}
+	return func(ctx context.Context) error {
+		// the spans are flushed to the file before it is closed
+		return errors.Join(tp.Shutdown(ctx), file.Close())
+	}, nil
+}
+
+// Per-request state used to create the decode and encode spans, since the
+// marshaler doesn't have access to the request context.
+type requestTrace struct {
+	method     string
+	start      time.Time
+	backendEnd time.Time
+}
+
+type requestTraceKey struct{}
+
+// This handler starts a server span for each request, continuing the trace of
+// the incoming traceparent header if present.
+func tracingHandler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		rm, w, r := trackRequestMetrics(w, r)
+		ctx := otel.GetTextMapPropagator().Extract(r.Context(), propagation.HeaderCarrier(r.Header))
+		rt := &requestTrace{method: r.Method, start: time.Now()}
+		ctx, span := otel.Tracer(tracerName).Start(ctx, r.Method+" "+r.URL.Path,
+			trace.WithSpanKind(trace.SpanKindServer), trace.WithTimestamp(rt.start),
+			trace.WithAttributes(attribute.String("http.method", r.Method), attribute.String("url.path", r.URL.Path)))
+		defer span.End()
+
+		next.ServeHTTP(w, r.WithContext(context.WithValue(ctx, requestTraceKey{}, rt)))
+
+		if !rt.backendEnd.IsZero() && !rm.firstWrite.IsZero() {
+			_, encode := otel.Tracer(tracerName).Start(ctx, "encode response", trace.WithTimestamp(rt.backendEnd))
+			encode.End(trace.WithTimestamp(rm.firstWrite))
+		}
+		code := rm.statusCode()
+		span.SetAttributes(attribute.Int("http.status_code", code), attribute.Int64("http.response_content_length", rm.responseSize))
+		if code >= http.StatusInternalServerError {
+			span.SetStatus(codes.Error, http.StatusText(code))
+		}
+	})
+}
+
+// This interceptor names the server span after the matched route, records the
+// time spent decoding the request, and creates a client span for the call to
+// the inference server, propagating the trace context in the gRPC metadata.
+func tracingInterceptor(ctx context.Context, method string, req, reply interface{},
+	cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+	tracer := otel.Tracer(tracerName)
+	rt, _ := ctx.Value(requestTraceKey{}).(*requestTrace)
+	if rt != nil {
+		server := trace.SpanFromContext(ctx)
+		if route, ok := runtime.HTTPPathPattern(ctx); ok {
+			server.SetName(rt.method + " " + route)
+		}
+		switch r := req.(type) {
+		case *gw.ModelInferRequest:
+			server.SetAttributes(attribute.String("model.name", r.ModelName), attribute.String("model.version", r.ModelVersion),
+				attribute.String("inference.id", r.Id))
+		case *gw.ModelMetadataRequest:
+			server.SetAttributes(attribute.String("model.name", r.Name), attribute.String("model.version", r.Version))
+		case *gw.ModelReadyRequest:
+			server.SetAttributes(attribute.String("model.name", r.Name), attribute.String("model.version", r.Version))
+		}
+		_, decode := tracer.Start(ctx, "decode request", trace.WithTimestamp(rt.start))
+		decode.End()
+	}
+
+	ctx, span := tracer.Start(ctx, method, trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(attribute.String("rpc.system", "grpc")))
+	defer span.End()
+	md, _ := metadata.FromOutgoingContext(ctx)
+	md = md.Copy()
+	otel.GetTextMapPropagator().Inject(ctx, metadataCarrier(md))
+	err := invoker(metadata.NewOutgoingContext(ctx, md), method, req, reply, cc, opts...)
+
+	s := status.Convert(err)
+	span.SetAttributes(attribute.Int("rpc.grpc.status_code", int(s.Code())))
+	if err != nil {
+		span.SetStatus(codes.Error, s.Message())
+	}
+	if rt != nil {
+		rt.backendEnd = time.Now()
+	}
+	return err
+}
+
+// Adapts gRPC metadata to the OpenTelemetry propagation API.
+type metadataCarrier metadata.MD
+
+func (c metadataCarrier) Get(key string) string {
+	if v := metadata.MD(c).Get(key); len(v) != 0 {
+		return v[0]
+	}
+	return ""
+}
+
+func (c metadataCarrier) Set(key, value string) {
+	metadata.MD(c).Set(key, value)
+}
+
+func (c metadataCarrier) Keys() []string {
+	keys := make([]string, 0, len(c))
+	for k := range c {
+		keys = append(keys, k)
+	}
+	return keys
+}
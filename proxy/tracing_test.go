@@ -0,0 +1,118 @@
+/*
+Copyright 2021 IBM Corporation
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"go.opentelemetry.io/otel"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"google.golang.org/grpc/metadata"
+
+	gw "github.com/kserve/rest-proxy/gen"
+)
+
+type tracingTestServer struct {
+	testInferServer
+	traceparent chan string
+}
+
+func (s *tracingTestServer) ModelInfer(ctx context.Context, req *gw.ModelInferRequest) (*gw.ModelInferResponse, error) {
+	md, _ := metadata.FromIncomingContext(ctx)
+	s.traceparent <- strings.Join(md.Get("traceparent"), ",")
+	return s.testInferServer.ModelInfer(ctx, req)
+}
+
+func TestTracing(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	prevProvider, prevPropagator := otel.GetTracerProvider(), otel.GetTextMapPropagator()
+	t.Cleanup(func() {
+		otel.SetTracerProvider(prevProvider)
+		otel.SetTextMapPropagator(prevPropagator)
+	})
+	if _, err := setupTracing(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+
+	srv := &tracingTestServer{traceparent: make(chan string, 1)}
+	handler := newTestProxy(t, srv, nil, nil, nil)
+	r := httptest.NewRequest("POST", "/v2/models/example/infer", strings.NewReader(inferRequestBody))
+	r.Header.Set("traceparent", "00-0af7651916cd43dd8448eb211c80319c-b7ad6b7169203331-01")
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, r)
+	if w.Code != http.StatusOK {
+		t.Fatalf("unexpected status %d: %s", w.Code, w.Body.String())
+	}
+
+	spans := recorder.Ended()
+	names := make([]string, len(spans))
+	for i, span := range spans {
+		names[i] = span.Name()
+		if tid := span.SpanContext().TraceID().String(); tid != "0af7651916cd43dd8448eb211c80319c" {
+			t.Errorf("expected span %s to continue the incoming trace, got trace id %s", span.Name(), tid)
+		}
+	}
+	expected := []string{"decode request", "/inference.GRPCInferenceService/ModelInfer", "encode response",
+		"POST /v2/models/{model_name}/infer"}
+	if d := cmp.Diff(expected, names); d != "" {
+		t.Errorf("diff :%s", d)
+	}
+
+	// the gRPC server receives the context of the client span
+	traceparent := <-srv.traceparent
+	if expected := "00-0af7651916cd43dd8448eb211c80319c-" + spans[1].SpanContext().SpanID().String() + "-01"; traceparent != expected {
+		t.Errorf("expected traceparent %s, got %s", expected, traceparent)
+	}
+}
+
+func TestTracingFileExporter(t *testing.T) {
+	prevProvider, prevPropagator := otel.GetTracerProvider(), otel.GetTextMapPropagator()
+	t.Cleanup(func() {
+		otel.SetTracerProvider(prevProvider)
+		otel.SetTextMapPropagator(prevPropagator)
+	})
+	path := filepath.Join(t.TempDir(), "traces.json")
+	t.Setenv(tracingExporterEnvVar, "file")
+	t.Setenv(tracingFileEnvVar, path)
+	shutdown, err := setupTracing(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, span := otel.Tracer(tracerName).Start(context.Background(), "test span")
+	span.End()
+	if err = shutdown(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	// the spans are flushed before the file is closed
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(data), `"Name":"test span"`) {
+		t.Errorf("expected the span to be written to the file, got %s", data)
+	}
+}